@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// agentConfigAnnotationPrefix is followed by the template key, the annotation holds the rendered Vault Agent config
+	agentConfigAnnotationPrefix = "vault-webhook.uswitch.com/agent-config-"
+	agentConfigMountPath        = "/vault/config"
+	agentConfigFile             = "agent.hcl"
+	// agentStartupTimeout is how many seconds the agent has to render the credentials before the kubelet restarts it
+	agentStartupTimeout = 300
+)
+
+// vaultAgentProvider runs HashiCorp Vault Agent with a config the webhook renders from the binding,
+// logging in with the Kubernetes auth method and rendering the binding's template as an agent template
+type vaultAgentProvider struct{}
+
+// There's no init container: one would log in and render the credentials with a lease of its own that
+// nothing renews, so only the sidecar renders them and its startup probe holds up the pod's containers
+// until they're written
+func (vaultAgentProvider) Containers(pod *corev1.Pod, d database) (*corev1.Container, corev1.Container) {
+	sidecar := corev1.Container{
+		Image:           vaultAgentImage,
+		ImagePullPolicy: "Always",
+		Command:         []string{"vault"},
+		Args:            []string{"agent", "-config=" + agentConfigMountPath + "/" + agentConfigFile},
+		Env: []corev1.EnvVar{
+			// the image otherwise tries to give the binary IPC_LOCK, which the restricted security context drops
+			corev1.EnvVar{Name: "SKIP_SETCAP", Value: "true"},
+			corev1.EnvVar{Name: "VAULT_LOG_FORMAT", Value: "json"},
+		},
+		VolumeMounts: append(credentialVolumeMounts(d), corev1.VolumeMount{
+			Name:      d.agentConfigVolumeName(),
+			MountPath: agentConfigMountPath,
+			ReadOnly:  true,
+		}),
+	}
+	// the templates read their secrets in the namespace too, not only the auto_auth login
+	sidecar.Env = append(sidecar.Env, d.vaultNamespaceEnv()...)
+
+	sidecar.StartupProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"test", "-f", d.outputFilePath()},
+			},
+		},
+		PeriodSeconds:    1,
+		FailureThreshold: agentStartupTimeout,
+	}
+
+	return nil, sidecar
+}
+
+// Vault Agent doesn't exit once the pod's containers are done, and nothing else would write the
+// credentials before they start
+func (vaultAgentProvider) NeedsNativeSidecar() bool {
+	return true
+}
+
+func (vaultAgentProvider) Volumes(d database) []corev1.Volume {
+	return append(credentialVolumes(d), corev1.Volume{
+		Name: d.agentConfigVolumeName(),
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{
+					{
+						DownwardAPI: &corev1.DownwardAPIProjection{
+							Items: []corev1.DownwardAPIVolumeFile{
+								{
+									Path: agentConfigFile,
+									FieldRef: &corev1.ObjectFieldSelector{
+										FieldPath: fmt.Sprintf("metadata.annotations['%s']", agentConfigAnnotation(d)),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+func (vaultAgentProvider) Annotations(d database) map[string]string {
+	annotations := map[string]string{agentConfigAnnotation(d): vaultAgentConfig(d)}
+	for name, value := range credentialAnnotations(d) {
+		annotations[name] = value
+	}
+	return annotations
+}
+
+// The volume the agent config is projected into
+func (d database) agentConfigVolumeName() string {
+	return "vault-agent-" + strings.TrimPrefix(d.containerName(), "vault-creds-")
+}
+
+// The pod annotation carrying the agent config
+func agentConfigAnnotation(d database) string {
+	return agentConfigAnnotationPrefix + templateKey(d.database, d.role)
+}
+
+// vaultAgentConfig renders the agent config for a database, HCL strings are quoted the same way as Go's
+func vaultAgentConfig(d database) string {
+	connection := d.vaultConnection()
+	var config strings.Builder
+
+	config.WriteString("vault {\n")
+	fmt.Fprintf(&config, "  address = %s\n", strconv.Quote(connection.address))
+	if ca := connection.caCertPath(); ca != "" {
+		fmt.Fprintf(&config, "  ca_cert = %s\n", strconv.Quote(ca))
+	}
+	config.WriteString("}\n\n")
+
+	config.WriteString("auto_auth {\n")
+	config.WriteString("  method \"kubernetes\" {\n")
+	fmt.Fprintf(&config, "    mount_path = %s\n", strconv.Quote(agentMountPath(d.vaultLoginPath())))
+	if namespace := d.effectiveVaultNamespace(); namespace != "" {
+		fmt.Fprintf(&config, "    namespace = %s\n", strconv.Quote(namespace))
+	}
+	config.WriteString("    config = {\n")
+	fmt.Fprintf(&config, "      role = %s\n", strconv.Quote(d.authRole))
+	config.WriteString("    }\n")
+	config.WriteString("  }\n")
+	config.WriteString("}\n\n")
+
+	config.WriteString("template_config {\n")
+	config.WriteString("  exit_on_retry_failure = true\n")
+	config.WriteString("}\n\n")
+
+	config.WriteString("template {\n")
+	fmt.Fprintf(&config, "  source = %s\n", strconv.Quote("/creds/template/"+templateKey(d.database, d.role)))
+	fmt.Fprintf(&config, "  destination = %s\n", strconv.Quote(d.outputFilePath()))
+	config.WriteString("}\n")
+
+	return config.String()
+}
+
+// agentMountPath turns a vault-creds login path like kubernetes/login into the auth mount Vault Agent wants, auth/kubernetes
+func agentMountPath(loginPath string) string {
+	return "auth/" + strings.TrimSuffix(strings.Trim(loginPath, "/"), "/login")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestVaultAgentConfig(t *testing.T) {
+	connection := newVaultConnection(&v1alpha1.VaultConnection{
+		Spec: v1alpha1.VaultConnectionSpec{
+			Address:   "https://vault.example.com",
+			LoginPath: "kubernetes-eu/login",
+			Namespace: "team-a",
+			CA:        &v1alpha1.VaultCASource{Path: "/etc/ssl/vault.pem"},
+		},
+	})
+	d := database{database: "mydb", role: "readonly", outputFile: "db.json", authRole: "mydb_ns_worker", connection: &connection}
+
+	expected := `vault {
+  address = "https://vault.example.com"
+  ca_cert = "/etc/ssl/vault.pem"
+}
+
+auto_auth {
+  method "kubernetes" {
+    mount_path = "auth/kubernetes-eu"
+    namespace = "team-a"
+    config = {
+      role = "mydb_ns_worker"
+    }
+  }
+}
+
+template_config {
+  exit_on_retry_failure = true
+}
+
+template {
+  source = "/creds/template/mydb-readonly"
+  destination = "/creds/output/db.json"
+}
+`
+	if config := vaultAgentConfig(d); config != expected {
+		t.Errorf("unexpected config, expected:\n%s\ngot:\n%s", expected, config)
+	}
+}
+
+func TestAgentMountPath(t *testing.T) {
+	for loginPath, expected := range map[string]string{
+		"kubernetes/login":            "auth/kubernetes",
+		"/kubernetes/eu-west-1/login": "auth/kubernetes/eu-west-1",
+		"kubernetes":                  "auth/kubernetes",
+	} {
+		if mountPath := agentMountPath(loginPath); mountPath != expected {
+			t.Errorf("expected %s for %s, got: %s", expected, loginPath, mountPath)
+		}
+	}
+}
+
+func TestCreatePatchVaultAgent(t *testing.T) {
+	vaultAgentImage = "hashicorp/vault:test"
+	defer func() { vaultAgentImage = "" }()
+
+	databases := []database{
+		{database: "mydb", role: "readonly", provider: v1alpha1.SidecarProviderVaultAgent, nativeSidecar: true, restricted: true},
+		{database: "otherdb", role: "readonly"},
+	}
+	pod := makePodOwnedByKind("Job")
+	patch, err := createPatch(pod, "ns", databases)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ops []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	json.Unmarshal(patch, &ops)
+
+	containers := map[string]v1.Container{}
+	volumes := map[string]bool{}
+	annotations := map[string]string{}
+	for _, op := range ops {
+		switch {
+		case op.Path == "/spec/containers/-":
+			var c v1.Container
+			json.Unmarshal(op.Value, &c)
+			containers[c.Name] = c
+		case op.Path == "/spec/initContainers":
+			var cs []v1.Container
+			json.Unmarshal(op.Value, &cs)
+			for _, c := range cs {
+				containers[c.Name] = c
+			}
+		case strings.HasPrefix(op.Path, "/spec/volumes"):
+			var vs []v1.Volume
+			if json.Unmarshal(op.Value, &vs) != nil {
+				var v v1.Volume
+				json.Unmarshal(op.Value, &v)
+				vs = []v1.Volume{v}
+			}
+			for _, v := range vs {
+				volumes[v.Name] = true
+			}
+		case op.Path == "/metadata/annotations":
+			json.Unmarshal(op.Value, &annotations)
+		}
+	}
+
+	agent := containers["vault-creds-mydb-readonly"]
+	if agent.Image != "hashicorp/vault:test" || strings.Join(agent.Args, " ") != "agent -config=/vault/config/agent.hcl" {
+		t.Errorf("expected the sidecar to run vault agent, got: %s %v", agent.Image, agent.Args)
+	}
+	if agent.SecurityContext == nil || agent.SecurityContext.RunAsNonRoot == nil {
+		t.Errorf("expected the sidecar to get the webhook's security context, got: %+v", agent.SecurityContext)
+	}
+	if agent.RestartPolicy == nil || *agent.RestartPolicy != v1.ContainerRestartPolicyAlways {
+		t.Errorf("expected the agent to be a native sidecar, got: %v", agent.RestartPolicy)
+	}
+	if agent.StartupProbe == nil || strings.Join(agent.StartupProbe.Exec.Command, " ") != "test -f /creds/output/mydb-readonly" {
+		t.Errorf("expected the agent to hold up the pod until the credentials are written, got: %+v", agent.StartupProbe)
+	}
+	if _, ok := containers["vault-creds-mydb-readonly-init"]; ok {
+		t.Error("expected no init container rendering credentials of its own for the agent")
+	}
+	if !volumes["vault-agent-mydb-readonly"] || volumes["vault-agent-otherdb-readonly"] {
+		t.Errorf("expected an agent config volume only for the vault-agent binding, got: %v", volumes)
+	}
+	if !strings.Contains(annotations[agentConfigAnnotationPrefix+"mydb-readonly"], "auto_auth") {
+		t.Errorf("expected the agent config annotation, got: %v", annotations)
+	}
+
+	creds := containers["vault-creds-otherdb-readonly"]
+	if creds.Image != sidecarImage || creds.Args[len(creds.Args)-1] != "--job" {
+		t.Errorf("expected vault-creds with --job for the other binding, got: %s %v", creds.Image, creds.Args)
+	}
+}
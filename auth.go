@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+const defaultAuthRoleTemplate = "{{ .Database }}_{{ .Namespace }}_{{ .ServiceAccount }}"
+
+// authRoleTemplate names the Vault role of bindings that don't set authRole, from --auth-role-template
+var authRoleTemplate = template.Must(parseAuthRoleTemplate(defaultAuthRoleTemplate))
+
+// authRoleData is what the auth role template is executed with
+type authRoleData struct {
+	Database       string
+	Role           string
+	Namespace      string
+	ServiceAccount string
+	ClusterName    string
+}
+
+// parseAuthRoleTemplate parses the template and tries it out, so mistakes like unknown fields
+// are found at startup rather than when pods are admitted
+func parseAuthRoleTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("auth-role").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, authRoleData{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// vaultAuthRole is the binding's authRole, or the auth role template executed for the pod
+func vaultAuthRole(d database, namespace string) (string, error) {
+	if d.authRole != "" {
+		return d.authRole, nil
+	}
+
+	var role bytes.Buffer
+	err := authRoleTemplate.Execute(&role, authRoleData{
+		Database:       d.database,
+		Role:           d.role,
+		Namespace:      namespace,
+		ServiceAccount: d.serviceAccount,
+		ClusterName:    clusterName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error executing the auth role template: %v", err)
+	}
+	if role.Len() == 0 {
+		return "", fmt.Errorf("the auth role template gave an empty role")
+	}
+	return role.String(), nil
+}
+
+// vaultLoginPath is the binding's loginPath, or that of its Vault connection
+func (d database) vaultLoginPath() string {
+	if d.loginPath != "" {
+		return d.loginPath
+	}
+	return d.vaultConnection().loginPath
+}
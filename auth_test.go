@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestVaultAuthRole(t *testing.T) {
+	defer func() {
+		authRoleTemplate, _ = parseAuthRoleTemplate(defaultAuthRoleTemplate)
+		clusterName = ""
+	}()
+	clusterName = "eu-west-1"
+
+	var tests = []struct {
+		scenario string
+		template string
+		database database
+		expected string
+		err      bool
+	}{
+		{
+			scenario: "default template",
+			template: defaultAuthRoleTemplate,
+			database: database{database: "foo", role: "bah", serviceAccount: "worker"},
+			expected: "foo_ns_worker",
+		},
+		{
+			scenario: "binding auth role",
+			template: defaultAuthRoleTemplate,
+			database: database{database: "foo", role: "bah", serviceAccount: "worker", authRole: "shared-foo"},
+			expected: "shared-foo",
+		},
+		{
+			scenario: "template with the role and cluster name",
+			template: "{{ .ClusterName }}-{{ .Database }}-{{ .Role }}-{{ .ServiceAccount }}",
+			database: database{database: "foo", role: "bah", serviceAccount: "worker"},
+			expected: "eu-west-1-foo-bah-worker",
+		},
+		{
+			scenario: "template giving an empty role",
+			template: "{{ if .ServiceAccount }}{{ .Database }}{{ end }}",
+			database: database{database: "foo", role: "bah"},
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			var err error
+			authRoleTemplate, err = parseAuthRoleTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("unexpected error parsing template: %v", err)
+			}
+			role, err := vaultAuthRole(tt.database, "ns")
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got role: %s", role)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if role != tt.expected {
+				t.Errorf("expected role %s, got: %s", tt.expected, role)
+			}
+		})
+	}
+}
+
+func TestParseAuthRoleTemplate(t *testing.T) {
+	for _, text := range []string{"{{ .Database", "{{ .Cluster }}"} {
+		if _, err := parseAuthRoleTemplate(text); err == nil {
+			t.Errorf("expected an error parsing %q", text)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	caMountPath = "/creds/ca"
+	caFile      = "ca.crt"
+)
+
+// vaultConnection is the Vault cluster a sidecar gets its credentials from, either from
+// a VaultConnection or the default one made up of the webhook's flags
+type vaultConnection struct {
+	name           string
+	address        string
+	ca             *v1alpha1.VaultCASource
+	loginPath      string
+	namespace      string
+	gatewayAddress string
+}
+
+func defaultVaultConnection() vaultConnection {
+	return vaultConnection{
+		address:        vaultAddr,
+		ca:             &v1alpha1.VaultCASource{Path: vaultCaPath},
+		loginPath:      loginPath,
+		namespace:      defaultVaultNamespace,
+		gatewayAddress: gatewayAddr,
+	}
+}
+
+// newVaultConnection is the connection described by a VaultConnection, falling back to --login-path
+// when it doesn't set one as the sidecar can't log in without it
+func newVaultConnection(connection *v1alpha1.VaultConnection) vaultConnection {
+	c := vaultConnection{
+		name:           connection.Name,
+		address:        connection.Spec.Address,
+		ca:             connection.Spec.CA,
+		loginPath:      connection.Spec.LoginPath,
+		namespace:      connection.Spec.Namespace,
+		gatewayAddress: connection.Spec.GatewayAddress,
+	}
+	if c.loginPath == "" {
+		c.loginPath = loginPath
+	}
+	return c
+}
+
+// vaultConnection is the database's VaultConnection, or the default connection when the binding doesn't name one
+func (d database) vaultConnection() vaultConnection {
+	if d.connection != nil {
+		return *d.connection
+	}
+	return defaultVaultConnection()
+}
+
+// effectiveVaultNamespace is the database's Vault Enterprise namespace, the binding's vaultNamespace or that of its Vault connection
+func (d database) effectiveVaultNamespace() string {
+	namespace := d.vaultNamespace
+	if namespace == "" {
+		namespace = d.vaultConnection().namespace
+	}
+	return strings.Trim(namespace, "/")
+}
+
+// vaultNamespaceEnv sets VAULT_NAMESPACE for the database's Vault Enterprise namespace, the Vault API
+// client sends it as X-Vault-Namespace so the secret and login paths stay relative to the namespace
+func (d database) vaultNamespaceEnv() []corev1.EnvVar {
+	namespace := d.effectiveVaultNamespace()
+	if namespace == "" {
+		return nil
+	}
+	return []corev1.EnvVar{{Name: "VAULT_NAMESPACE", Value: namespace}}
+}
+
+// hasCAVolume is true when the CA bundle comes from a ConfigMap or Secret rather than the sidecar image
+func (c vaultConnection) hasCAVolume() bool {
+	return c.ca != nil && (c.ca.ConfigMapKeyRef != nil || c.ca.SecretKeyRef != nil)
+}
+
+// The --ca-cert the sidecar is given, empty uses the system's CAs
+func (c vaultConnection) caCertPath() string {
+	switch {
+	case c.hasCAVolume():
+		return caMountPath + "/" + caFile
+	case c.ca != nil:
+		return c.ca.Path
+	}
+	return ""
+}
+
+// The volume a database's CA bundle is projected into, when its connection has one in a ConfigMap or Secret
+func (d database) caVolumeName() string {
+	return "vault-ca-" + strings.TrimPrefix(d.containerName(), "vault-creds-")
+}
+
+// caVolume projects the connection's CA bundle key into a file the sidecar can read
+func caVolume(d database) corev1.Volume {
+	ca := d.vaultConnection().ca
+	var source corev1.VolumeProjection
+
+	if ref := ca.ConfigMapKeyRef; ref != nil {
+		source.ConfigMap = &corev1.ConfigMapProjection{
+			LocalObjectReference: ref.LocalObjectReference,
+			Items:                []corev1.KeyToPath{{Key: ref.Key, Path: caFile}},
+			Optional:             ref.Optional,
+		}
+	} else if ref := ca.SecretKeyRef; ref != nil {
+		source.Secret = &corev1.SecretProjection{
+			LocalObjectReference: ref.LocalObjectReference,
+			Items:                []corev1.KeyToPath{{Key: ref.Key, Path: caFile}},
+			Optional:             ref.Optional,
+		}
+	}
+
+	return corev1.Volume{
+		Name: d.caVolumeName(),
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{source},
+			},
+		},
+	}
+}
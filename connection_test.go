@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestAddVaultConnection(t *testing.T) {
+	vaultAddr, vaultCaPath, gatewayAddr = "https://vault.example.com", "/etc/ssl/vault.pem", "http://pushgateway:9091"
+	secretPathFormat = "%s/creds/%s"
+	defer func() { vaultAddr, vaultCaPath, gatewayAddr, secretPathFormat = "", "", "", "" }()
+
+	regional := newVaultConnection(&v1alpha1.VaultConnection{
+		Spec: v1alpha1.VaultConnectionSpec{
+			Address:        "https://vault.eu-west-1.example.com",
+			Namespace:      "team-a",
+			LoginPath:      "kubernetes-eu/login",
+			GatewayAddress: "http://pushgateway.eu-west-1:9091",
+			CA: &v1alpha1.VaultCASource{
+				ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "vault-ca"}, Key: "ca.pem"},
+			},
+		},
+	})
+	databases := []database{
+		{database: "foo", role: "bah"},
+		{database: "baz", role: "foo", connection: &regional},
+	}
+
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app"}}}}
+	patch, err := createPatch(pod, "ns", databases)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ops []struct {
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	json.Unmarshal(patch, &ops)
+
+	var containers []v1.Container
+	var caVolume *v1.Volume
+	for _, op := range ops {
+		switch op.Path {
+		case "/spec/containers/-":
+			var c v1.Container
+			json.Unmarshal(op.Value, &c)
+			containers = append(containers, c)
+		case "/spec/volumes/-":
+			var volume v1.Volume
+			json.Unmarshal(op.Value, &volume)
+			if volume.Name == "vault-ca-baz-foo" {
+				caVolume = &volume
+			}
+		}
+	}
+	if len(containers) != 2 {
+		t.Fatalf("expected two sidecars, got: %d", len(containers))
+	}
+
+	expected := map[string][]string{
+		"vault-creds-foo-bah": {"--vault-addr=https://vault.example.com", "--ca-cert=/etc/ssl/vault.pem", "--gateway-addr=http://pushgateway:9091", "--secret-path=foo/creds/bah"},
+		"vault-creds-baz-foo": {"--vault-addr=https://vault.eu-west-1.example.com", "--ca-cert=/creds/ca/ca.crt", "--gateway-addr=http://pushgateway.eu-west-1:9091",
+			"--secret-path=baz/creds/foo", "--login-path=kubernetes-eu/login"},
+	}
+	for _, c := range containers {
+		for _, want := range expected[c.Name] {
+			found := false
+			for _, arg := range c.Args {
+				if arg == want {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected %s in the args of %s, got: %v", want, c.Name, c.Args)
+			}
+		}
+
+		namespaced := false
+		for _, env := range c.Env {
+			if env.Name == "VAULT_NAMESPACE" && env.Value == "team-a" {
+				namespaced = true
+			}
+		}
+		if namespaced != (c.Name == "vault-creds-baz-foo") {
+			t.Errorf("expected VAULT_NAMESPACE only for vault-creds-baz-foo, got env %v for %s", c.Env, c.Name)
+		}
+
+		mounted := false
+		for _, mount := range c.VolumeMounts {
+			if mount.Name == "vault-ca-baz-foo" && mount.MountPath == "/creds/ca" {
+				mounted = true
+			}
+		}
+		if mounted != (c.Name == "vault-creds-baz-foo") {
+			t.Errorf("expected the CA volume to be mounted only for vault-creds-baz-foo, got mounts %v for %s", c.VolumeMounts, c.Name)
+		}
+	}
+
+	if caVolume == nil {
+		t.Fatalf("expected the CA volume to be added, got: %s", patch)
+	}
+	configMap := caVolume.Projected.Sources[0].ConfigMap
+	if configMap == nil || configMap.Name != "vault-ca" || configMap.Items[0].Key != "ca.pem" || configMap.Items[0].Path != caFile {
+		t.Errorf("expected the vault-ca ConfigMap to be projected, got: %+v", caVolume.Projected.Sources[0])
+	}
+}
+
+func TestVaultNamespaceEnv(t *testing.T) {
+	defaultVaultNamespace = "platform"
+	defer func() { defaultVaultNamespace = "" }()
+	team := vaultConnection{namespace: "team-a/"}
+
+	var tests = []struct {
+		database database
+		expected string
+	}{
+		{database{}, "platform"},
+		{database{connection: &team}, "team-a"},
+		{database{connection: &team, vaultNamespace: "/platform/team-b/"}, "platform/team-b"},
+		{database{connection: &vaultConnection{}}, ""},
+	}
+	for _, tt := range tests {
+		env := tt.database.vaultNamespaceEnv()
+		switch {
+		case tt.expected == "" && len(env) != 0:
+			t.Errorf("expected no VAULT_NAMESPACE, got: %v", env)
+		case tt.expected != "" && (len(env) != 1 || env[0].Name != "VAULT_NAMESPACE" || env[0].Value != tt.expected):
+			t.Errorf("expected VAULT_NAMESPACE=%s, got: %v", tt.expected, env)
+		}
+	}
+}
+
+func TestNewVaultConnectionLoginPath(t *testing.T) {
+	loginPath = "kubernetes/login"
+	defer func() { loginPath = "" }()
+
+	connection := newVaultConnection(&v1alpha1.VaultConnection{Spec: v1alpha1.VaultConnectionSpec{Address: "https://vault.example.com"}})
+	if path := (database{connection: &connection}).vaultLoginPath(); path != "kubernetes/login" {
+		t.Errorf("expected a VaultConnection without a loginPath to use --login-path, got: %q", path)
+	}
+
+	connection = newVaultConnection(&v1alpha1.VaultConnection{Spec: v1alpha1.VaultConnectionSpec{LoginPath: "kubernetes-eu/login"}})
+	if path := (database{connection: &connection}).vaultLoginPath(); path != "kubernetes-eu/login" {
+		t.Errorf("expected the VaultConnection's loginPath, got: %q", path)
+	}
+}
@@ -3,10 +3,20 @@ package main
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
@@ -80,3 +90,365 @@ func (b *bindingAggregator) List() ([]v1alpha1.DatabaseCredentialBinding, error)
 func (b *bindingAggregator) cacheSize() int {
 	return len(b.store.List())
 }
+
+// clusterBindingAggregator watches ClusterDatabaseCredentialBindings, it shares the
+// event handling and caching of bindingAggregator and only differs in what it lists.
+type clusterBindingAggregator struct {
+	bindingAggregator
+}
+
+func NewClusterListWatch(client *webhookclient.Clientset) *clusterBindingAggregator {
+	binder := &clusterBindingAggregator{}
+	watcher := cache.NewListWatchFromClient(client.VaultwebhookV1alpha1().RESTClient(), "clusterdatabasecredentialbindings", "", fields.Everything())
+
+	informerOptions := cache.InformerOptions{
+		ListerWatcher: watcher,
+		ObjectType:    &v1alpha1.ClusterDatabaseCredentialBinding{},
+		Handler:       binder,
+		ResyncPeriod:  time.Minute,
+		Indexers:      cache.Indexers{},
+	}
+	binder.store, binder.controller = cache.NewInformerWithOptions(informerOptions)
+	cacheSize := prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "cluster_database_credential_binding_cache_size",
+			Help: "Current size of the Cluster Database Credential Binding cache",
+		},
+		func() float64 { return float64(binder.cacheSize()) },
+	)
+	prometheus.MustRegister(cacheSize)
+	return binder
+}
+
+func (b *clusterBindingAggregator) List() ([]v1alpha1.ClusterDatabaseCredentialBinding, error) {
+	bindingList := make([]v1alpha1.ClusterDatabaseCredentialBinding, 0)
+	bindings := b.store.List()
+	for _, obj := range bindings {
+		binding, ok := obj.(*v1alpha1.ClusterDatabaseCredentialBinding)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object in store: %+v", obj)
+		}
+		bindingList = append(bindingList, *binding)
+	}
+	return bindingList, nil
+}
+
+// connectionAggregator watches VaultConnections, which bindings look up by name
+type connectionAggregator struct {
+	bindingAggregator
+}
+
+func NewConnectionListWatch(client *webhookclient.Clientset) *connectionAggregator {
+	connections := &connectionAggregator{}
+	watcher := cache.NewListWatchFromClient(client.VaultwebhookV1alpha1().RESTClient(), "vaultconnections", "", fields.Everything())
+
+	informerOptions := cache.InformerOptions{
+		ListerWatcher: watcher,
+		ObjectType:    &v1alpha1.VaultConnection{},
+		Handler:       connections,
+		ResyncPeriod:  time.Minute,
+		Indexers:      cache.Indexers{},
+	}
+	connections.store, connections.controller = cache.NewInformerWithOptions(informerOptions)
+	cacheSize := prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Name: "vault_connection_cache_size",
+			Help: "Current size of the Vault Connection cache",
+		},
+		func() float64 { return float64(connections.cacheSize()) },
+	)
+	prometheus.MustRegister(cacheSize)
+	return connections
+}
+
+// Get returns the named VaultConnection, or nil if there isn't one
+func (c *connectionAggregator) Get(name string) (*v1alpha1.VaultConnection, error) {
+	obj, exists, err := c.store.GetByKey(name)
+	if err != nil || !exists {
+		return nil, err
+	}
+	connection, ok := obj.(*v1alpha1.VaultConnection)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object in store: %+v", obj)
+	}
+	return connection, nil
+}
+
+// statusReconciler keeps the status of DatabaseCredentialBindings up to date. Only one
+// replica of the webhook should update statuses so it's run under leader election.
+type statusReconciler struct {
+	client        kubernetes.Interface
+	webhookClient webhookclient.Interface
+	bindings      *bindingAggregator
+	interval      time.Duration
+}
+
+func NewStatusReconciler(client kubernetes.Interface, webhookClient webhookclient.Interface, bindings *bindingAggregator, interval time.Duration) *statusReconciler {
+	return &statusReconciler{
+		client:        client,
+		webhookClient: webhookClient,
+		bindings:      bindings,
+		interval:      interval,
+	}
+}
+
+// RunWithLeaderElection blocks, reconciling statuses whenever this replica holds the lease, until ctx is done
+func (r *statusReconciler) RunWithLeaderElection(ctx context.Context, namespace, name, identity string) error {
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, name, r.client.CoreV1(), r.client.CoordinationV1(), resourcelock.ResourceLockConfig{
+		Identity: identity,
+	})
+	if err != nil {
+		return err
+	}
+
+	// RunOrDie returns when leadership is lost, so go back to waiting for the lease
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					log.Infof("%s became leader, reconciling binding statuses", identity)
+					wait.UntilWithContext(ctx, r.reconcile, r.interval)
+				},
+				OnStoppedLeading: func() {
+					log.Infof("%s stopped leading", identity)
+				},
+			},
+		})
+	}
+	return nil
+}
+
+func (r *statusReconciler) reconcile(ctx context.Context) {
+	bindings, err := r.bindings.List()
+	if err != nil {
+		log.Errorf("error listing bindings: %v", err)
+		return
+	}
+
+	byNamespace := map[string][]v1alpha1.DatabaseCredentialBinding{}
+	for _, binding := range bindings {
+		byNamespace[binding.Namespace] = append(byNamespace[binding.Namespace], binding)
+	}
+
+	for namespace, bindings := range byNamespace {
+		if err := r.reconcileNamespace(ctx, namespace, bindings); err != nil {
+			log.Errorf("error reconciling binding statuses in %s: %v", namespace, err)
+		}
+	}
+}
+
+func (r *statusReconciler) reconcileNamespace(ctx context.Context, namespace string, bindings []v1alpha1.DatabaseCredentialBinding) error {
+	pods, err := r.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	serviceAccounts, err := r.client.CoreV1().ServiceAccounts(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	configMaps, err := r.client.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	resources := namespaceResources{
+		pods:            pods.Items,
+		serviceAccounts: map[string]bool{},
+		configMaps:      map[string]corev1.ConfigMap{},
+	}
+	for _, serviceAccount := range serviceAccounts.Items {
+		resources.serviceAccounts[serviceAccount.Name] = true
+	}
+	for _, configMap := range configMaps.Items {
+		resources.configMaps[configMap.Name] = configMap
+	}
+
+	for _, binding := range bindings {
+		status := bindingStatus(binding, resources)
+		if equality.Semantic.DeepEqual(status, binding.Status) {
+			continue
+		}
+
+		updated := binding.DeepCopy()
+		updated.Status = status
+		if _, err := r.webhookClient.VaultwebhookV1alpha1().DatabaseCredentialBindings(namespace).UpdateStatus(updated); err != nil {
+			log.Errorf("error updating status of binding %s/%s: %v", namespace, binding.Name, err)
+		}
+	}
+	return nil
+}
+
+// namespaceResources is what bindingStatus needs to know about the binding's namespace
+type namespaceResources struct {
+	pods            []corev1.Pod
+	serviceAccounts map[string]bool
+	configMaps      map[string]corev1.ConfigMap
+}
+
+func bindingStatus(binding v1alpha1.DatabaseCredentialBinding, resources namespaceResources) v1alpha1.DatabaseCredentialBindingStatus {
+	status := *binding.Status.DeepCopy()
+	generation := binding.Generation
+
+	missing := []string{}
+	for _, serviceAccount := range append([]string{binding.Spec.ServiceAccount}, binding.Spec.ServiceAccounts...) {
+		if serviceAccount != "" && !resources.serviceAccounts[serviceAccount] {
+			missing = appendStringIfMissing(missing, serviceAccount)
+		}
+	}
+	if len(missing) == 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               v1alpha1.ServiceAccountExists,
+			Status:             metav1.ConditionTrue,
+			Reason:             "ServiceAccountsFound",
+			Message:            "All bound service accounts exist",
+			ObservedGeneration: generation,
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               v1alpha1.ServiceAccountExists,
+			Status:             metav1.ConditionFalse,
+			Reason:             "ServiceAccountsNotFound",
+			Message:            fmt.Sprintf("Service accounts not found: %s", strings.Join(missing, ", ")),
+			ObservedGeneration: generation,
+		})
+	}
+
+	d := database{database: binding.Spec.Database, role: binding.Spec.Role}
+	matched := []corev1.Pod{}
+	for _, pod := range resources.pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if !binding.Spec.HasServiceAccount(pod.Spec.ServiceAccountName) || !matchPodSelector(binding, &pod) {
+			continue
+		}
+		if hasSidecar(&pod, d.containerName()) {
+			matched = append(matched, pod)
+		}
+	}
+
+	status.MatchedPods = int32(len(matched))
+	for _, pod := range matched {
+		if status.LastInjectionTime == nil || status.LastInjectionTime.Before(&pod.CreationTimestamp) {
+			created := pod.CreationTimestamp
+			status.LastInjectionTime = &created
+		}
+	}
+
+	if len(matched) == 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               v1alpha1.Injected,
+			Status:             metav1.ConditionFalse,
+			Reason:             "NoPodsInjected",
+			Message:            "No running pods have been injected",
+			ObservedGeneration: generation,
+		})
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               v1alpha1.TemplateFound,
+			Status:             metav1.ConditionUnknown,
+			Reason:             "NoPodsInjected",
+			Message:            "No running pods to check for templates",
+			ObservedGeneration: generation,
+		})
+		return status
+	}
+
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               v1alpha1.Injected,
+		Status:             metav1.ConditionTrue,
+		Reason:             "PodsInjected",
+		Message:            fmt.Sprintf("Injected into %d running pods", len(matched)),
+		ObservedGeneration: generation,
+	})
+
+	key := templateKey(binding.Spec.Database, binding.Spec.Role)
+	withoutTemplate := []string{}
+	for _, pod := range matched {
+		if !podHasTemplate(&pod, d, resources.configMaps) {
+			withoutTemplate = append(withoutTemplate, pod.Name)
+		}
+	}
+	if len(withoutTemplate) == 0 {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               v1alpha1.TemplateFound,
+			Status:             metav1.ConditionTrue,
+			Reason:             "TemplateFound",
+			Message:            fmt.Sprintf("Template %s found for all injected pods", key),
+			ObservedGeneration: generation,
+		})
+	} else {
+		sort.Strings(withoutTemplate)
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               v1alpha1.TemplateFound,
+			Status:             metav1.ConditionFalse,
+			Reason:             "TemplateNotFound",
+			Message:            fmt.Sprintf("Template %s not found in the template volumes of pods: %s", key, strings.Join(withoutTemplate, ", ")),
+			ObservedGeneration: generation,
+		})
+	}
+
+	return status
+}
+
+// podHasTemplate checks the template volume the webhook projected for the binding, or the pod's
+// vault-template ConfigMap volume, provides the template key
+func podHasTemplate(pod *corev1.Pod, d database, configMaps map[string]corev1.ConfigMap) bool {
+	key := templateKey(d.database, d.role)
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name == d.templateVolumeName() && volume.Projected != nil {
+			return projectionHasTemplate(volume.Projected, key, configMaps)
+		}
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name != defaultTemplateVolumeName {
+			continue
+		}
+		// only ConfigMaps are checked, trust any other kind of volume
+		if volume.ConfigMap == nil {
+			return true
+		}
+		configMap, ok := configMaps[volume.ConfigMap.Name]
+		if !ok {
+			return false
+		}
+		return configMapHasKey(configMap, volume.ConfigMap.Items, key)
+	}
+	return false
+}
+
+// projectionHasTemplate checks the ConfigMaps in a template volume, an inline template or Secret is trusted
+func projectionHasTemplate(projected *corev1.ProjectedVolumeSource, key string, configMaps map[string]corev1.ConfigMap) bool {
+	for _, source := range projected.Sources {
+		if source.ConfigMap == nil {
+			continue
+		}
+		configMap, ok := configMaps[source.ConfigMap.Name]
+		if !ok || !configMapHasKey(configMap, source.ConfigMap.Items, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// configMapHasKey checks a ConfigMap volume will contain a file named key
+func configMapHasKey(configMap corev1.ConfigMap, items []corev1.KeyToPath, key string) bool {
+	if len(items) == 0 {
+		_, inData := configMap.Data[key]
+		_, inBinaryData := configMap.BinaryData[key]
+		return inData || inBinaryData
+	}
+	for _, item := range items {
+		if item.Path == key {
+			_, inData := configMap.Data[item.Key]
+			_, inBinaryData := configMap.BinaryData[item.Key]
+			return inData || inBinaryData
+		}
+	}
+	return false
+}
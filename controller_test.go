@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	webhookfake "github.com/uswitch/vault-webhook/pkg/client/clientset/versioned/fake"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func injectedPod(name string, created time.Time, phase v1.PodPhase, templateConfigMap string) v1.Pod {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "foo", CreationTimestamp: metav1.NewTime(created)},
+		Spec: v1.PodSpec{
+			ServiceAccountName: "foo",
+			Containers:         []v1.Container{v1.Container{Name: "app"}, v1.Container{Name: "vault-creds-mydb-readonly"}},
+		},
+		Status: v1.PodStatus{Phase: phase},
+	}
+	if templateConfigMap != "" {
+		pod.Spec.Volumes = []v1.Volume{
+			v1.Volume{
+				Name: "vault-template",
+				VolumeSource: v1.VolumeSource{
+					ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: templateConfigMap}},
+				},
+			},
+		}
+	}
+	return pod
+}
+
+func TestBindingStatus(t *testing.T) {
+	binding := v1alpha1.DatabaseCredentialBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "mybinding", Namespace: "foo", Generation: 2},
+		Spec: v1alpha1.DatabaseCredentialBindingSpec{
+			ServiceAccount:  "foo",
+			ServiceAccounts: []string{"bah"},
+			Database:        "mydb",
+			Role:            "readonly",
+		},
+	}
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	resources := namespaceResources{
+		pods: []v1.Pod{
+			injectedPod("first", earlier, v1.PodRunning, "templates"),
+			injectedPod("second", later, v1.PodPending, "templates"),
+			injectedPod("finished", later.Add(time.Hour), v1.PodSucceeded, "templates"),
+			v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "uninjected"}, Spec: v1.PodSpec{ServiceAccountName: "foo"}},
+		},
+		serviceAccounts: map[string]bool{"foo": true},
+		configMaps: map[string]v1.ConfigMap{
+			"templates": v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "templates"}, Data: map[string]string{"mydb-readonly": "{{ .Username }}"}},
+		},
+	}
+
+	status := bindingStatus(binding, resources)
+	if status.MatchedPods != 2 {
+		t.Errorf("expected 2 matched pods, got: %d", status.MatchedPods)
+	}
+	if status.LastInjectionTime == nil || !status.LastInjectionTime.Time.Equal(later) {
+		t.Errorf("expected last injection time %v, got: %v", later, status.LastInjectionTime)
+	}
+	if !meta.IsStatusConditionFalse(status.Conditions, v1alpha1.ServiceAccountExists) {
+		t.Errorf("service account bah is missing, got: %+v", meta.FindStatusCondition(status.Conditions, v1alpha1.ServiceAccountExists))
+	}
+	if !meta.IsStatusConditionTrue(status.Conditions, v1alpha1.Injected) {
+		t.Errorf("expected injected condition, got: %+v", meta.FindStatusCondition(status.Conditions, v1alpha1.Injected))
+	}
+	if !meta.IsStatusConditionTrue(status.Conditions, v1alpha1.TemplateFound) {
+		t.Errorf("expected template found condition, got: %+v", meta.FindStatusCondition(status.Conditions, v1alpha1.TemplateFound))
+	}
+	if c := meta.FindStatusCondition(status.Conditions, v1alpha1.Injected); c == nil || c.ObservedGeneration != 2 {
+		t.Errorf("expected observed generation 2, got: %+v", c)
+	}
+
+	inline := injectedPod("inline", earlier, v1.PodRunning, "")
+	inline.Spec.Volumes = []v1.Volume{templateVolume(database{database: "mydb", role: "readonly", template: "{{ .Username }}"})}
+	resources.pods = append(resources.pods, inline)
+	status = bindingStatus(binding, resources)
+	if !meta.IsStatusConditionTrue(status.Conditions, v1alpha1.TemplateFound) {
+		t.Errorf("inline template should be found, got: %+v", meta.FindStatusCondition(status.Conditions, v1alpha1.TemplateFound))
+	}
+
+	fromConfigMap := injectedPod("fromconfigmap", earlier, v1.PodRunning, "")
+	fromConfigMap.Spec.Volumes = []v1.Volume{templateVolume(database{database: "mydb", role: "readonly", templateFrom: &v1alpha1.TemplateSource{
+		ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "missing"}, Key: "readonly"},
+	}})}
+	resources.pods = append(resources.pods, fromConfigMap)
+	status = bindingStatus(binding, resources)
+	if !meta.IsStatusConditionFalse(status.Conditions, v1alpha1.TemplateFound) {
+		t.Errorf("templateFrom a missing config map should not be found, got: %+v", meta.FindStatusCondition(status.Conditions, v1alpha1.TemplateFound))
+	}
+	resources.configMaps["missing"] = v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "missing"}, Data: map[string]string{"readonly": "{{ .Username }}"}}
+	status = bindingStatus(binding, resources)
+	if !meta.IsStatusConditionTrue(status.Conditions, v1alpha1.TemplateFound) {
+		t.Errorf("templateFrom config map should be found, got: %+v", meta.FindStatusCondition(status.Conditions, v1alpha1.TemplateFound))
+	}
+	delete(resources.configMaps, "missing")
+
+	resources.pods = append(resources.pods, injectedPod("notemplate", earlier, v1.PodRunning, "missing"))
+	status = bindingStatus(binding, resources)
+	if !meta.IsStatusConditionFalse(status.Conditions, v1alpha1.TemplateFound) {
+		t.Errorf("expected template not found condition, got: %+v", meta.FindStatusCondition(status.Conditions, v1alpha1.TemplateFound))
+	}
+}
+
+func TestConfigMapHasKey(t *testing.T) {
+	configMap := v1.ConfigMap{Data: map[string]string{"mydb-readonly": "", "other": ""}}
+
+	if !configMapHasKey(configMap, nil, "mydb-readonly") {
+		t.Error("key should be found without items")
+	}
+	if configMapHasKey(configMap, []v1.KeyToPath{{Key: "other", Path: "other"}}, "mydb-readonly") {
+		t.Error("key should not be found when it isn't projected")
+	}
+	if !configMapHasKey(configMap, []v1.KeyToPath{{Key: "other", Path: "mydb-readonly"}}, "mydb-readonly") {
+		t.Error("key should be found when projected to the template path")
+	}
+}
+
+func TestReconcileStatus(t *testing.T) {
+	binding := &v1alpha1.DatabaseCredentialBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "mybinding", Namespace: "foo"},
+		Spec: v1alpha1.DatabaseCredentialBindingSpec{
+			ServiceAccount: "foo",
+			Database:       "mydb",
+			Role:           "readonly",
+		},
+	}
+	pod := injectedPod("first", time.Now(), v1.PodRunning, "")
+
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	store.Add(binding)
+	client := fake.NewClientset(&pod, &v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"}})
+	webhookClient := webhookfake.NewSimpleClientset(binding)
+
+	reconciler := NewStatusReconciler(client, webhookClient, &bindingAggregator{store: store}, time.Minute)
+	reconciler.reconcile(context.Background())
+
+	updated, err := webhookClient.VaultwebhookV1alpha1().DatabaseCredentialBindings("foo").Get("mybinding", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Status.MatchedPods != 1 {
+		t.Errorf("expected 1 matched pod, got: %d", updated.Status.MatchedPods)
+	}
+	if !meta.IsStatusConditionTrue(updated.Status.Conditions, v1alpha1.ServiceAccountExists) {
+		t.Errorf("expected service account exists condition, got: %+v", updated.Status.Conditions)
+	}
+	if !meta.IsStatusConditionFalse(updated.Status.Conditions, v1alpha1.TemplateFound) {
+		t.Errorf("pod has no vault-template volume, got: %+v", updated.Status.Conditions)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Event reasons
+const (
+	reasonCredentialsInjected = "CredentialsInjected"
+	reasonInjectionSkipped    = "InjectionSkipped"
+	reasonPatchFailed         = "PatchFailed"
+)
+
+var eventScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(eventScheme))
+	utilruntime.Must(v1alpha1.AddToScheme(eventScheme))
+}
+
+func NewEventRecorder(client kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(eventScheme, corev1.EventSource{Component: "vault-webhook"})
+}
+
+// recordEvent records the event against each object, unless the request is a dry run
+func (srv webHookServer) recordEvent(req *admissionv1.AdmissionRequest, objects []*corev1.ObjectReference, eventType, reason, messageFmt string, args ...interface{}) {
+	if srv.recorder == nil || (req.DryRun != nil && *req.DryRun) {
+		return
+	}
+	for _, object := range objects {
+		if object != nil {
+			srv.recorder.Eventf(object, eventType, reason, messageFmt, args...)
+		}
+	}
+}
+
+// ownerReference refers to the pod's controller, pods are usually created without a name so
+// it's where events about the pod are most likely to be seen
+func ownerReference(pod *corev1.Pod, namespace string) *corev1.ObjectReference {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return nil
+	}
+	return &corev1.ObjectReference{
+		APIVersion: owner.APIVersion,
+		Kind:       owner.Kind,
+		Name:       owner.Name,
+		UID:        owner.UID,
+		Namespace:  namespace,
+	}
+}
+
+// bindingReference refers to the binding a database came from, cluster bindings converted by
+// filterClusterBindings keep their own kind
+func bindingReference(binding v1alpha1.DatabaseCredentialBinding) *corev1.ObjectReference {
+	ref := &corev1.ObjectReference{
+		APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		Kind:       "DatabaseCredentialBinding",
+		Name:       binding.Name,
+		Namespace:  binding.Namespace,
+		UID:        binding.UID,
+	}
+	if binding.Kind == "ClusterDatabaseCredentialBinding" {
+		ref.Kind = binding.Kind
+		ref.Namespace = ""
+	}
+	return ref
+}
+
+func databaseBindings(databases []database) []*corev1.ObjectReference {
+	refs := []*corev1.ObjectReference{}
+	for _, d := range databases {
+		refs = append(refs, d.binding)
+	}
+	return refs
+}
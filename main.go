@@ -11,8 +11,10 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
 	webhook "github.com/uswitch/vault-webhook/pkg/client/clientset/versioned"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -26,6 +28,27 @@ var (
 	secretPathFormat string
 	sidecarImage     string
 	serverAddress    string
+	sidecarMode      string
+	vaultAgentImage  string
+
+	sidecarCPURequest    string
+	sidecarMemoryRequest string
+	sidecarCPULimit      string
+	sidecarMemoryLimit   string
+
+	defaultRenewInterval time.Duration
+	defaultLeaseDuration time.Duration
+	sidecarRunAsUser     int64
+
+	missingTemplatePolicy string
+	authRoleTemplateText  string
+	clusterName           string
+	defaultVaultNamespace string
+
+	volumeSizeLimit string
+
+	statusInterval          time.Duration
+	leaderElectionNamespace string
 )
 
 func main() {
@@ -35,8 +58,28 @@ func main() {
 	kingpin.Flag("login-path", "Kubernetes auth login path for vault").Required().StringVar(&loginPath)
 	kingpin.Flag("sidecar-image", "Vault-creds sidecar image to use").Required().StringVar(&sidecarImage)
 	kingpin.Flag("gateway-address", "URL of Push Gateway").StringVar(&gatewayAddr)
+	kingpin.Flag("vault-namespace", "Vault Enterprise namespace of the secret and login paths, given to the sidecar as VAULT_NAMESPACE, for bindings that don't set one").StringVar(&defaultVaultNamespace)
 	kingpin.Flag("secret-path-format", "The format for the path used for reading database credentials, where the first %s is the database name and the second %s is the role").Default("%s/creds/%s").StringVar(&secretPathFormat)
 	kingpin.Flag("server-address", "The address the webhook server will listen on.").Default(":8443").StringVar(&serverAddress)
+	kingpin.Flag("sidecar-provider", "What fetches the credentials for bindings that don't set a provider, the vault-creds sidecar or Vault Agent").Default(v1alpha1.SidecarProviderVaultCreds).EnumVar(&defaultSidecarProvider, v1alpha1.SidecarProviderVaultCreds, v1alpha1.SidecarProviderVaultAgent)
+	kingpin.Flag("vault-agent-image", "Vault image to use for the vault-agent provider").Default("hashicorp/vault:1.18").StringVar(&vaultAgentImage)
+	kingpin.Flag("sidecar-mode", "Run vault-creds as a native sidecar (an init container with restartPolicy: Always) or a regular container, auto uses native sidecars on Kubernetes 1.29+").Default(sidecarModeAuto).EnumVar(&sidecarMode, sidecarModeAuto, v1alpha1.SidecarModeNative, v1alpha1.SidecarModeLegacy)
+	kingpin.Flag("volume-isolation", "Whether the credentials of all a pod's bindings share the vault-creds volume, or each binding gets a volume of its own, for bindings that don't set one").Default(v1alpha1.VolumeIsolationShared).EnumVar(&defaultVolumeIsolation, v1alpha1.VolumeIsolationShared, v1alpha1.VolumeIsolationBinding)
+	kingpin.Flag("volume-medium", "Whether the credentials volumes are kept in memory (a tmpfs) or on the node's disk, for bindings that don't set one").Default(v1alpha1.VolumeMediumMemory).EnumVar(&defaultVolumeMedium, v1alpha1.VolumeMediumMemory, v1alpha1.VolumeMediumDisk)
+	kingpin.Flag("volume-size-limit", "Size limit of the credentials volumes, for bindings that don't set one, empty for none").StringVar(&volumeSizeLimit)
+	kingpin.Flag("sidecar-cpu-request", "Default CPU request for the vault-creds containers, empty for none").Default("10m").StringVar(&sidecarCPURequest)
+	kingpin.Flag("sidecar-memory-request", "Default memory request for the vault-creds containers, empty for none").Default("20Mi").StringVar(&sidecarMemoryRequest)
+	kingpin.Flag("sidecar-cpu-limit", "Default CPU limit for the vault-creds containers, empty for none").Default("30m").StringVar(&sidecarCPULimit)
+	kingpin.Flag("sidecar-memory-limit", "Default memory limit for the vault-creds containers, empty for none").Default("50Mi").StringVar(&sidecarMemoryLimit)
+	kingpin.Flag("renew-interval", "Default interval at which the sidecar renews the credentials lease").Default("1h").DurationVar(&defaultRenewInterval)
+	kingpin.Flag("lease-duration", "Default duration of the credentials lease, capped at the activeDeadlineSeconds of job-like pods").Default("12h").DurationVar(&defaultLeaseDuration)
+	kingpin.Flag("restricted-security-context", "Give the vault-creds containers a security context that passes the Pod Security restricted profile in every namespace, not only those enforcing it").BoolVar(&restrictedSecurityContext)
+	kingpin.Flag("sidecar-run-as-user", "User the vault-creds containers run as with the restricted security context when the pod doesn't set runAsUser, 0 leaves it to the image").Default("65534").Int64Var(&sidecarRunAsUser)
+	kingpin.Flag("missing-template-policy", "Whether pods without the vault-template volume or key for a binding are denied or allowed with a warning").Default(missingTemplatePolicyWarn).EnumVar(&missingTemplatePolicy, missingTemplatePolicyWarn, missingTemplatePolicyDeny)
+	kingpin.Flag("auth-role-template", "Go template for the Vault role of bindings that don't set authRole, with .Database, .Role, .Namespace, .ServiceAccount and .ClusterName").Default(defaultAuthRoleTemplate).StringVar(&authRoleTemplateText)
+	kingpin.Flag("cluster-name", "Name of the cluster, available to --auth-role-template as .ClusterName").StringVar(&clusterName)
+	kingpin.Flag("status-interval", "How often the leader updates the status of DatabaseCredentialBindings").Default("1m").DurationVar(&statusInterval)
+	kingpin.Flag("leader-election-namespace", "Namespace of the lease used to elect the replica that updates binding statuses").Default("kube-system").StringVar(&leaderElectionNamespace)
 	kingpin.Parse()
 	log.SetOutput(os.Stderr)
 
@@ -63,7 +106,32 @@ func main() {
 		log.Fatalf("error creating webhook client: %s", err)
 	}
 
+	nativeSidecars, err := nativeSidecarsEnabled(sidecarMode, client.Discovery())
+	if err != nil {
+		log.Fatalf("error resolving sidecar mode: %s", err)
+	}
+	log.Infof("Using native sidecars: %t", nativeSidecars)
+
+	authRoleTemplate, err = parseAuthRoleTemplate(authRoleTemplateText)
+	if err != nil {
+		log.Fatalf("error parsing auth role template: %s", err)
+	}
+
+	resources, err := defaultSidecarResources(sidecarCPURequest, sidecarMemoryRequest, sidecarCPULimit, sidecarMemoryLimit)
+	if err != nil {
+		log.Fatalf("error parsing sidecar resources: %s", err)
+	}
+
+	defaultVolumeSizeLimit, err = parseVolumeSizeLimit(volumeSizeLimit)
+	if err != nil {
+		log.Fatalf("error parsing volume size limit: %s", err)
+	}
+
 	watcher := NewListWatch(webhookClient)
+	clusterWatcher := NewClusterListWatch(webhookClient)
+	connectionWatcher := NewConnectionListWatch(webhookClient)
+
+	informerFactory := informers.NewSharedInformerFactory(client, time.Minute)
 
 	srv := http.Server{Addr: serverAddress}
 
@@ -72,10 +140,20 @@ func main() {
 	srv.TLSConfig = t
 
 	whsvr := webHookServer{
-		server:   &srv,
-		client:   client,
-		bindings: watcher,
-		ctx:      ctx,
+		server:                &srv,
+		client:                client,
+		bindings:              watcher,
+		clusterBindings:       clusterWatcher,
+		connections:           connectionWatcher,
+		namespaces:            informerFactory.Core().V1().Namespaces().Lister(),
+		limitRanges:           informerFactory.Core().V1().LimitRanges().Lister(),
+		jobs:                  informerFactory.Batch().V1().Jobs().Lister(),
+		configMaps:            informerFactory.Core().V1().ConfigMaps().Lister(),
+		recorder:              NewEventRecorder(client),
+		nativeSidecars:        nativeSidecars,
+		sidecarResources:      resources,
+		missingTemplatePolicy: missingTemplatePolicy,
+		ctx:                   ctx,
 	}
 
 	cont := ctrl.SetupSignalHandler()
@@ -84,6 +162,7 @@ func main() {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/mutate", whsvr.serve)
+	mux.HandleFunc("/validate", whsvr.serveValidate)
 	promhandler := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, mux)
 
 	whsvr.server.Handler = promhandler
@@ -98,12 +177,27 @@ func main() {
 	}
 
 	watcher.Run(ctx)
+	clusterWatcher.Run(ctx)
+	connectionWatcher.Run(ctx)
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
 
 	log.Info("Waiting for informer caches to sync")
-	if ok := watcher.controller.HasSynced(); !ok {
+	if ok := watcher.controller.HasSynced() && clusterWatcher.controller.HasSynced() && connectionWatcher.controller.HasSynced(); !ok {
 		log.Fatal("failed to wait for caches to sync")
 	}
 
+	identity, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("error getting hostname for leader election: %s", err)
+	}
+	reconciler := NewStatusReconciler(client, webhookClient, watcher, statusInterval)
+	go func() {
+		if err := reconciler.RunWithLeaderElection(ctx, leaderElectionNamespace, "vault-webhook", identity); err != nil {
+			log.Errorf("Failed to run binding status reconciler: %v", err)
+		}
+	}()
+
 	log.Info("starting server")
 
 	// start webhook server in new rountine
@@ -31,6 +31,10 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&DatabaseCredentialBinding{},
 		&DatabaseCredentialBindingList{},
+		&ClusterDatabaseCredentialBinding{},
+		&ClusterDatabaseCredentialBindingList{},
+		&VaultConnection{},
+		&VaultConnectionList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
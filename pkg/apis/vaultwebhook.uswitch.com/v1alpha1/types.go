@@ -2,26 +2,98 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // +genclient
-// +genclient:noStatus
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 type DatabaseCredentialBinding struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
-	Spec              DatabaseCredentialBindingSpec `json:"spec"`
+	Spec              DatabaseCredentialBindingSpec   `json:"spec"`
+	Status            DatabaseCredentialBindingStatus `json:"status,omitempty"`
 }
 
 type DatabaseCredentialBindingSpec struct {
-	Database       string    `json:"database"`
-	Role           string    `json:"role"`
-	OutputPath     string    `json:"outputPath"`
-	OutputFile     string    `json:"outputFile"`
-	ServiceAccount string    `json:"serviceAccount"`
-	Container      Container `json:"container,omitempty"`
+	Database       string `json:"database"`
+	Role           string `json:"role"`
+	OutputPath     string `json:"outputPath"`
+	OutputFile     string `json:"outputFile"`
+	ServiceAccount string `json:"serviceAccount"`
+	// ServiceAccounts binds several ServiceAccounts at once, alongside ServiceAccount
+	ServiceAccounts []string  `json:"serviceAccounts,omitempty"`
+	Container       Container `json:"container,omitempty"`
+	// PodSelector further restricts the binding to pods with matching labels, on top of the ServiceAccount
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// RenewInterval is how often the sidecar renews the lease, defaults to the webhook's --renew-interval
+	RenewInterval *metav1.Duration `json:"renewInterval,omitempty"`
+	// LeaseDuration is the lease the sidecar asks for, defaults to the webhook's --lease-duration.
+	// It's capped at the activeDeadlineSeconds of job-like pods.
+	LeaseDuration *metav1.Duration `json:"leaseDuration,omitempty"`
+	// Template is the vault-creds template for the credentials, used instead of the
+	// <database>-<role> key of the pod's vault-template volume
+	Template string `json:"template,omitempty"`
+	// TemplateFrom reads the template from a ConfigMap or Secret key, instead of the vault-template volume
+	TemplateFrom *TemplateSource `json:"templateFrom,omitempty"`
+	// AuthRole is the Vault role the sidecar logs in with, instead of the one from the webhook's --auth-role-template
+	AuthRole string `json:"authRole,omitempty"`
+	// LoginPath is the Vault Kubernetes auth login path, instead of the VaultConnection's or the webhook's --login-path
+	LoginPath string `json:"loginPath,omitempty"`
+	// VaultConnection is the name of the VaultConnection to get the credentials from,
+	// the webhook's --vault-address and related flags are used when it's empty
+	VaultConnection string `json:"vaultConnection,omitempty"`
+	// VaultNamespace is the Vault Enterprise namespace of the database secrets engine and Kubernetes auth,
+	// instead of the VaultConnection's namespace or the webhook's --vault-namespace
+	VaultNamespace string `json:"vaultNamespace,omitempty"`
+	// EnvVar is the environment variable given the path of the credentials file in the pod's
+	// containers, instead of VAULT_CREDS_<DATABASE>_<ROLE>_FILE
+	EnvVar string `json:"envVar,omitempty"`
+	// Containers are the names of the pod's containers that get the credentials mounted,
+	// all of them do when it's empty
+	Containers []string `json:"containers,omitempty"`
+	// InitContainers is whether the pod's init containers get the credentials mounted, defaults to true
+	InitContainers *bool `json:"initContainers,omitempty"`
+	// Volume configures the emptyDir volume the credentials are written to
+	Volume CredentialsVolume `json:"volume,omitempty"`
+}
+
+// TemplateSource selects the key of a ConfigMap or Secret in the binding's namespace, only one may be set
+type TemplateSource struct {
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	SecretKeyRef    *corev1.SecretKeySelector    `json:"secretKeyRef,omitempty"`
+}
+
+// Condition types reported in DatabaseCredentialBindingStatus
+const (
+	// ServiceAccountExists is true when every bound ServiceAccount exists in the namespace
+	ServiceAccountExists = "ServiceAccountExists"
+	// TemplateFound is true when every injected pod has the template for the database and role
+	TemplateFound = "TemplateFound"
+	// Injected is true when the binding has been injected into at least one running pod
+	Injected = "Injected"
+)
+
+type DatabaseCredentialBindingStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// LastInjectionTime is the creation time of the most recent pod the binding was injected into
+	LastInjectionTime *metav1.Time `json:"lastInjectionTime,omitempty"`
+	// MatchedPods is the number of running pods the binding has been injected into
+	MatchedPods int32 `json:"matchedPods"`
+}
+
+// HasServiceAccount checks the name against both ServiceAccount and ServiceAccounts
+func (s DatabaseCredentialBindingSpec) HasServiceAccount(name string) bool {
+	if s.ServiceAccount == name {
+		return true
+	}
+	for _, serviceAccount := range s.ServiceAccounts {
+		if serviceAccount == name {
+			return true
+		}
+	}
+	return false
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -33,8 +105,117 @@ type DatabaseCredentialBindingList struct {
 	Items []DatabaseCredentialBinding `json:"items"`
 }
 
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterDatabaseCredentialBinding applies a DatabaseCredentialBindingSpec to every namespace matching its NamespaceSelector
+type ClusterDatabaseCredentialBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              ClusterDatabaseCredentialBindingSpec `json:"spec"`
+}
+
+type ClusterDatabaseCredentialBindingSpec struct {
+	DatabaseCredentialBindingSpec `json:",inline"`
+	NamespaceSelector             *metav1.LabelSelector `json:"namespaceSelector"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type ClusterDatabaseCredentialBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ClusterDatabaseCredentialBinding `json:"items"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// VaultConnection describes how the sidecar reaches a Vault cluster, bindings refer to it by name
+type VaultConnection struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              VaultConnectionSpec `json:"spec"`
+}
+
+type VaultConnectionSpec struct {
+	// Address is the URL of Vault
+	Address string `json:"address"`
+	// CA is where the sidecar gets the CA bundle for Vault's certificate from
+	CA *VaultCASource `json:"ca,omitempty"`
+	// LoginPath is the Kubernetes auth login path, defaults to the webhook's --login-path.
+	// A binding's loginPath takes precedence.
+	LoginPath string `json:"loginPath,omitempty"`
+	// Namespace is the Vault Enterprise namespace
+	Namespace string `json:"namespace,omitempty"`
+	// GatewayAddress is the URL of the Prometheus Pushgateway the sidecar pushes metrics to
+	GatewayAddress string `json:"gatewayAddress,omitempty"`
+}
+
+// VaultCASource is either a file in the sidecar image or a ConfigMap or Secret key in the pod's namespace, only one may be set
+type VaultCASource struct {
+	Path            string                       `json:"path,omitempty"`
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	SecretKeyRef    *corev1.SecretKeySelector    `json:"secretKeyRef,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type VaultConnectionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []VaultConnection `json:"items"`
+}
+
+const (
+	// SidecarModeNative runs vault-creds as an init container with restartPolicy: Always
+	SidecarModeNative = "native"
+	// SidecarModeLegacy runs vault-creds as a regular container, with --job for job-like pods
+	SidecarModeLegacy = "legacy"
+
+	// SidecarProviderVaultCreds runs the uswitch vault-creds sidecar
+	SidecarProviderVaultCreds = "vault-creds"
+	// SidecarProviderVaultAgent runs HashiCorp Vault Agent, with the template as a Vault Agent template
+	SidecarProviderVaultAgent = "vault-agent"
+
+	// VolumeIsolationShared writes the credentials of all the pod's bindings into the vault-creds volume
+	VolumeIsolationShared = "shared"
+	// VolumeIsolationBinding writes each binding's credentials into a volume of its own
+	VolumeIsolationBinding = "binding"
+
+	// VolumeMediumMemory keeps the credentials in a tmpfs, off the node's disk
+	VolumeMediumMemory = "Memory"
+	// VolumeMediumDisk writes the credentials to the node's disk
+	VolumeMediumDisk = "Disk"
+)
+
+// CredentialsVolume is the emptyDir volume the sidecar writes the credentials into and the pod's containers mount
+type CredentialsVolume struct {
+	// Isolation overrides the webhook's --volume-isolation for this binding, binding gives it its own
+	// vault-creds-<database>-<role> volume instead of sharing vault-creds with the pod's other bindings
+	Isolation string `json:"isolation,omitempty"`
+	// Medium overrides the webhook's --volume-medium for this binding, Memory for tmpfs or Disk for the node's disk
+	Medium string `json:"medium,omitempty"`
+	// SizeLimit overrides the webhook's --volume-size-limit for this binding
+	SizeLimit *resource.Quantity `json:"sizeLimit,omitempty"`
+}
+
 type Container struct {
 	Lifecycle corev1.Lifecycle `json:"lifecycle,omitempty"`
+	// SidecarMode overrides the webhook's --sidecar-mode for this binding, either native or legacy
+	SidecarMode string `json:"sidecarMode,omitempty"`
+	// Provider overrides the webhook's --sidecar-provider for this binding, either vault-creds or vault-agent
+	Provider string `json:"provider,omitempty"`
+	// Resources override the webhook's default requests and limits for the vault-creds containers
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// SecurityContext fields replace those of the restricted security context the webhook sets
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
 }
 
 /*
@@ -24,6 +24,7 @@ type DatabaseCredentialBindingsGetter interface {
 type DatabaseCredentialBindingInterface interface {
 	Create(*v1alpha1.DatabaseCredentialBinding) (*v1alpha1.DatabaseCredentialBinding, error)
 	Update(*v1alpha1.DatabaseCredentialBinding) (*v1alpha1.DatabaseCredentialBinding, error)
+	UpdateStatus(*v1alpha1.DatabaseCredentialBinding) (*v1alpha1.DatabaseCredentialBinding, error)
 	Delete(name string, options *v1.DeleteOptions) error
 	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
 	Get(name string, options v1.GetOptions) (*v1alpha1.DatabaseCredentialBinding, error)
@@ -119,6 +120,22 @@ func (c *databaseCredentialBindings) Update(databaseCredentialBinding *v1alpha1.
 	return
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *databaseCredentialBindings) UpdateStatus(databaseCredentialBinding *v1alpha1.DatabaseCredentialBinding) (result *v1alpha1.DatabaseCredentialBinding, err error) {
+	result = &v1alpha1.DatabaseCredentialBinding{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("databasecredentialbindings").
+		Name(databaseCredentialBinding.Name).
+		SubResource("status").
+		Body(databaseCredentialBinding).
+		Do(c.ctx).
+		Into(result)
+	return
+}
+
 // Delete takes name of the databaseCredentialBinding and deletes it. Returns an error if one occurs.
 func (c *databaseCredentialBindings) Delete(name string, options *v1.DeleteOptions) error {
 	return c.client.Delete().
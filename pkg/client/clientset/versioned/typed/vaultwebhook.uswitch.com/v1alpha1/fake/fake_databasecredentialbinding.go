@@ -84,6 +84,18 @@ func (c *FakeDatabaseCredentialBindings) Update(databaseCredentialBinding *v1alp
 	return obj.(*v1alpha1.DatabaseCredentialBinding), err
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeDatabaseCredentialBindings) UpdateStatus(databaseCredentialBinding *v1alpha1.DatabaseCredentialBinding) (*v1alpha1.DatabaseCredentialBinding, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(databasecredentialbindingsResource, "status", c.ns, databaseCredentialBinding), &v1alpha1.DatabaseCredentialBinding{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.DatabaseCredentialBinding), err
+}
+
 // Delete takes name of the databaseCredentialBinding and deletes it. Returns an error if one occurs.
 func (c *FakeDatabaseCredentialBindings) Delete(name string, options *v1.DeleteOptions) error {
 	_, err := c.Fake.
@@ -12,10 +12,18 @@ type FakeVaultwebhookV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeVaultwebhookV1alpha1) ClusterDatabaseCredentialBindings() v1alpha1.ClusterDatabaseCredentialBindingInterface {
+	return &FakeClusterDatabaseCredentialBindings{c}
+}
+
 func (c *FakeVaultwebhookV1alpha1) DatabaseCredentialBindings(namespace string) v1alpha1.DatabaseCredentialBindingInterface {
 	return &FakeDatabaseCredentialBindings{c, namespace}
 }
 
+func (c *FakeVaultwebhookV1alpha1) VaultConnections() v1alpha1.VaultConnectionInterface {
+	return &FakeVaultConnections{c}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeVaultwebhookV1alpha1) RESTClient() rest.Interface {
@@ -2,4 +2,8 @@
 
 package v1alpha1
 
+type ClusterDatabaseCredentialBindingExpansion interface{}
+
 type DatabaseCredentialBindingExpansion interface{}
+
+type VaultConnectionExpansion interface{}
@@ -11,7 +11,9 @@ import (
 
 type VaultwebhookV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	ClusterDatabaseCredentialBindingsGetter
 	DatabaseCredentialBindingsGetter
+	VaultConnectionsGetter
 }
 
 // VaultwebhookV1alpha1Client is used to interact with features provided by the vaultwebhook.uswitch.com group.
@@ -19,11 +21,21 @@ type VaultwebhookV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *VaultwebhookV1alpha1Client) ClusterDatabaseCredentialBindings() ClusterDatabaseCredentialBindingInterface {
+	ctx := context.Background()
+	return newClusterDatabaseCredentialBindings(ctx, c)
+}
+
 func (c *VaultwebhookV1alpha1Client) DatabaseCredentialBindings(namespace string) DatabaseCredentialBindingInterface {
 	ctx := context.Background()
 	return newDatabaseCredentialBindings(ctx, c, namespace)
 }
 
+func (c *VaultwebhookV1alpha1Client) VaultConnections() VaultConnectionInterface {
+	ctx := context.Background()
+	return newVaultConnections(ctx, c)
+}
+
 // NewForConfig creates a new VaultwebhookV1alpha1Client for the given config.
 func NewForConfig(c *rest.Config) (*VaultwebhookV1alpha1Client, error) {
 	config := *c
@@ -37,8 +37,12 @@ func (f *genericInformer) Lister() cache.GenericLister {
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
 	// Group=vaultwebhook.uswitch.com, Version=v1alpha1
+	case v1alpha1.SchemeGroupVersion.WithResource("clusterdatabasecredentialbindings"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Vaultwebhook().V1alpha1().ClusterDatabaseCredentialBindings().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("databasecredentialbindings"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Vaultwebhook().V1alpha1().DatabaseCredentialBindings().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("vaultconnections"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Vaultwebhook().V1alpha1().VaultConnections().Informer()}, nil
 
 	}
 
@@ -8,8 +8,12 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// ClusterDatabaseCredentialBindings returns a ClusterDatabaseCredentialBindingInformer.
+	ClusterDatabaseCredentialBindings() ClusterDatabaseCredentialBindingInformer
 	// DatabaseCredentialBindings returns a DatabaseCredentialBindingInformer.
 	DatabaseCredentialBindings() DatabaseCredentialBindingInformer
+	// VaultConnections returns a VaultConnectionInformer.
+	VaultConnections() VaultConnectionInformer
 }
 
 type version struct {
@@ -23,7 +27,17 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// ClusterDatabaseCredentialBindings returns a ClusterDatabaseCredentialBindingInformer.
+func (v *version) ClusterDatabaseCredentialBindings() ClusterDatabaseCredentialBindingInformer {
+	return &clusterDatabaseCredentialBindingInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // DatabaseCredentialBindings returns a DatabaseCredentialBindingInformer.
 func (v *version) DatabaseCredentialBindings() DatabaseCredentialBindingInformer {
 	return &databaseCredentialBindingInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// VaultConnections returns a VaultConnectionInformer.
+func (v *version) VaultConnections() VaultConnectionInformer {
+	return &vaultConnectionInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
@@ -2,6 +2,10 @@
 
 package v1alpha1
 
+// ClusterDatabaseCredentialBindingListerExpansion allows custom methods to be added to
+// ClusterDatabaseCredentialBindingLister.
+type ClusterDatabaseCredentialBindingListerExpansion interface{}
+
 // DatabaseCredentialBindingListerExpansion allows custom methods to be added to
 // DatabaseCredentialBindingLister.
 type DatabaseCredentialBindingListerExpansion interface{}
@@ -9,3 +13,7 @@ type DatabaseCredentialBindingListerExpansion interface{}
 // DatabaseCredentialBindingNamespaceListerExpansion allows custom methods to be added to
 // DatabaseCredentialBindingNamespaceLister.
 type DatabaseCredentialBindingNamespaceListerExpansion interface{}
+
+// VaultConnectionListerExpansion allows custom methods to be added to
+// VaultConnectionLister.
+type VaultConnectionListerExpansion interface{}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SidecarProvider turns a matched database into the containers that write its credentials into the
+// vault-creds volume. addVault takes care of naming, placing, securing and sizing the containers,
+// so providers only deal in images, arguments and the volumes the containers read from.
+type SidecarProvider interface {
+	// Containers returns the init container that writes the credentials before the pod's containers
+	// start, and the sidecar that keeps them renewed. There's no init container for a provider
+	// that needs a native sidecar, its sidecar holds up the pod's containers itself
+	Containers(pod *corev1.Pod, d database) (initContainer *corev1.Container, sidecar corev1.Container)
+	// NeedsNativeSidecar is true when the sidecar has to be a native sidecar to write the credentials
+	// before the pod's containers start and to stop once they're done
+	NeedsNativeSidecar() bool
+	// Volumes returns the volumes the containers need besides vault-creds
+	Volumes(d database) []corev1.Volume
+	// Annotations returns the pod annotations the volumes are projected from
+	Annotations(d database) map[string]string
+}
+
+// defaultSidecarProvider is used by bindings that don't set a provider, from --sidecar-provider
+var defaultSidecarProvider = v1alpha1.SidecarProviderVaultCreds
+
+var sidecarProviders = map[string]SidecarProvider{
+	v1alpha1.SidecarProviderVaultCreds: vaultCredsProvider{},
+	v1alpha1.SidecarProviderVaultAgent: vaultAgentProvider{},
+}
+
+// sidecarProvider is the database's provider, or the default one when it doesn't have one
+func (d database) sidecarProvider() SidecarProvider {
+	if provider, ok := sidecarProviders[d.provider]; ok {
+		return provider
+	}
+	return sidecarProviders[defaultSidecarProvider]
+}
+
+// credentialVolumes are the CA and template volumes of a database, which every provider reads from
+func credentialVolumes(d database) []corev1.Volume {
+	volumes := []corev1.Volume{}
+	if d.vaultConnection().hasCAVolume() {
+		volumes = append(volumes, caVolume(d))
+	}
+	if d.hasOwnTemplate() {
+		volumes = append(volumes, templateVolume(d))
+	}
+	return volumes
+}
+
+// credentialAnnotations holds an inline template for its template volume to be projected from
+func credentialAnnotations(d database) map[string]string {
+	if d.template == "" {
+		return nil
+	}
+	return map[string]string{templateAnnotation(d): d.template}
+}
+
+// credentialVolumeMounts mounts the template, output and CA volumes of a database
+func credentialVolumeMounts(d database) []corev1.VolumeMount {
+	mounts := []corev1.VolumeMount{
+		corev1.VolumeMount{
+			Name:      d.sidecarTemplateVolume(),
+			MountPath: "/creds/template",
+		},
+		corev1.VolumeMount{
+			Name:      d.credsVolumeName(),
+			MountPath: "/creds/output",
+		},
+	}
+	if d.vaultConnection().hasCAVolume() {
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      d.caVolumeName(),
+			MountPath: caMountPath,
+			ReadOnly:  true,
+		})
+	}
+	return mounts
+}
+
+// The name of the file the credentials are written to in the vault-creds volume
+func (d database) outputFileName() string {
+	if d.outputFile == "" {
+		return fmt.Sprintf("%s-%s", d.database, d.role)
+	}
+	return d.outputFile
+}
+
+// Where the sidecar writes the credentials
+func (d database) outputFilePath() string {
+	return "/creds/output/" + d.outputFileName()
+}
+
+// vaultCredsProvider runs the uswitch vault-creds sidecar
+type vaultCredsProvider struct{}
+
+func (vaultCredsProvider) Containers(pod *corev1.Pod, d database) (*corev1.Container, corev1.Container) {
+	connection := d.vaultConnection()
+
+	sidecar := corev1.Container{
+		Image:           sidecarImage,
+		ImagePullPolicy: "Always",
+		Args: []string{
+			"--vault-addr=" + connection.address,
+			"--gateway-addr=" + connection.gatewayAddress,
+			"--ca-cert=" + connection.caCertPath(),
+			"--secret-path=" + fmt.Sprintf(secretPathFormat, d.database, d.role),
+			"--login-path=" + d.vaultLoginPath(),
+			"--auth-role=" + d.authRole,
+			"--template=" + "/creds/template/" + templateKey(d.database, d.role),
+			"--out=" + d.outputFilePath(),
+			"--completed-path=/creds/output/completed",
+			"--renew-interval=" + d.renewInterval.String(),
+			"--lease-duration=" + d.leaseDuration.String(),
+			"--json-log",
+		},
+		Env: []corev1.EnvVar{
+			corev1.EnvVar{
+				Name: "POD_NAME",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{
+						FieldPath: "metadata.name",
+					},
+				},
+			},
+			corev1.EnvVar{
+				Name: "NAMESPACE",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{
+						FieldPath: "metadata.namespace",
+					},
+				},
+			},
+		},
+		VolumeMounts: credentialVolumeMounts(d),
+	}
+	sidecar.Env = append(sidecar.Env, d.vaultNamespaceEnv()...)
+
+	initContainer := *sidecar.DeepCopy()
+	initContainer.Args = append(initContainer.Args, "--init")
+
+	// A native sidecar is stopped by the kubelet once the pod's containers are done, so doesn't need --job
+	if d.waitsForCompletion(pod) {
+		sidecar.Args = append(sidecar.Args, "--job")
+	}
+
+	return &initContainer, sidecar
+}
+
+func (vaultCredsProvider) NeedsNativeSidecar() bool {
+	return false
+}
+
+// waitsForCompletion is whether the sidecar runs with --job, it then exits once the pod's containers have
+// written the completed marker into its volume, so they need to be able to write to it
+func (d database) waitsForCompletion(pod *corev1.Pod) bool {
+	return !d.nativeSidecar && isJobLike(pod)
+}
+
+func (vaultCredsProvider) Volumes(d database) []corev1.Volume {
+	return credentialVolumes(d)
+}
+
+func (vaultCredsProvider) Annotations(d database) map[string]string {
+	return credentialAnnotations(d)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// defaultSidecarResources builds the requests and limits used when a binding doesn't set them,
+// an empty quantity leaves that request or limit unset
+func defaultSidecarResources(cpuRequest, memoryRequest, cpuLimit, memoryLimit string) (corev1.ResourceRequirements, error) {
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{},
+		Limits:   corev1.ResourceList{},
+	}
+
+	quantities := []struct {
+		list  corev1.ResourceList
+		name  corev1.ResourceName
+		value string
+	}{
+		{resources.Requests, corev1.ResourceCPU, cpuRequest},
+		{resources.Requests, corev1.ResourceMemory, memoryRequest},
+		{resources.Limits, corev1.ResourceCPU, cpuLimit},
+		{resources.Limits, corev1.ResourceMemory, memoryLimit},
+	}
+	for _, q := range quantities {
+		if q.value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(q.value)
+		if err != nil {
+			return resources, fmt.Errorf("invalid %s quantity %q: %s", q.name, q.value, err)
+		}
+		q.list[q.name] = quantity
+	}
+
+	return resources, validateResources(resources)
+}
+
+// sidecarResources overrides the defaults with whatever the binding sets and then fits the result
+// into the namespace's LimitRanges. Values outside a LimitRange are clamped to it, an error is only
+// returned when no requests and limits can satisfy every LimitRange.
+func sidecarResources(defaults, override corev1.ResourceRequirements, limitRanges []corev1.LimitRange) (corev1.ResourceRequirements, error) {
+	resources := *defaults.DeepCopy()
+	if resources.Requests == nil {
+		resources.Requests = corev1.ResourceList{}
+	}
+	if resources.Limits == nil {
+		resources.Limits = corev1.ResourceList{}
+	}
+
+	for name, quantity := range override.Requests {
+		resources.Requests[name] = quantity
+		// a larger request than the default limit raises the limit, unless the binding set the limit too
+		if limit, ok := resources.Limits[name]; ok && quantity.Cmp(limit) > 0 {
+			if _, ok := override.Limits[name]; !ok {
+				resources.Limits[name] = quantity
+			}
+		}
+	}
+	for name, quantity := range override.Limits {
+		resources.Limits[name] = quantity
+	}
+	if err := validateResources(resources); err != nil {
+		return resources, err
+	}
+
+	for _, limitRange := range limitRanges {
+		for _, item := range limitRange.Spec.Limits {
+			if item.Type == corev1.LimitTypeContainer {
+				clampResources(&resources, item, limitRange.Name)
+			}
+		}
+	}
+
+	// clamping to one LimitRange can take us outside another
+	for _, limitRange := range limitRanges {
+		for _, item := range limitRange.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			if err := checkLimitRange(resources, item); err != nil {
+				return resources, fmt.Errorf("sidecar resources can't satisfy LimitRange %s: %s", limitRange.Name, err)
+			}
+		}
+	}
+
+	return resources, validateResources(resources)
+}
+
+func clampResources(resources *corev1.ResourceRequirements, item corev1.LimitRangeItem, limitRange string) {
+	for name, min := range item.Min {
+		if request, ok := resources.Requests[name]; !ok || request.Cmp(min) < 0 {
+			log.Infof("Raising sidecar %s request to the minimum %s of LimitRange %s", name, min.String(), limitRange)
+			resources.Requests[name] = min.DeepCopy()
+		}
+		if limit, ok := resources.Limits[name]; ok && limit.Cmp(min) < 0 {
+			log.Infof("Raising sidecar %s limit to the minimum %s of LimitRange %s", name, min.String(), limitRange)
+			resources.Limits[name] = min.DeepCopy()
+		}
+	}
+
+	for name, max := range item.Max {
+		if limit, ok := resources.Limits[name]; !ok || limit.Cmp(max) > 0 {
+			log.Infof("Lowering sidecar %s limit to the maximum %s of LimitRange %s", name, max.String(), limitRange)
+			resources.Limits[name] = max.DeepCopy()
+		}
+		if request, ok := resources.Requests[name]; ok && request.Cmp(max) > 0 {
+			log.Infof("Lowering sidecar %s request to the maximum %s of LimitRange %s", name, max.String(), limitRange)
+			resources.Requests[name] = max.DeepCopy()
+		}
+	}
+
+	for name, ratio := range item.MaxLimitRequestRatio {
+		limit, hasLimit := resources.Limits[name]
+		request, hasRequest := resources.Requests[name]
+		if !hasLimit || !hasRequest || request.IsZero() {
+			continue
+		}
+		if minRequest := minRequestForRatio(name, limit, ratio); request.Cmp(minRequest) < 0 {
+			log.Infof("Raising sidecar %s request to %s for the limit/request ratio %s of LimitRange %s", name, minRequest.String(), ratio.String(), limitRange)
+			resources.Requests[name] = minRequest
+		}
+	}
+}
+
+func checkLimitRange(resources corev1.ResourceRequirements, item corev1.LimitRangeItem) error {
+	for name, min := range item.Min {
+		if request, ok := resources.Requests[name]; !ok || request.Cmp(min) < 0 {
+			return fmt.Errorf("%s request must be at least %s", name, min.String())
+		}
+		if limit, ok := resources.Limits[name]; ok && limit.Cmp(min) < 0 {
+			return fmt.Errorf("%s limit %s is below the minimum %s", name, limit.String(), min.String())
+		}
+	}
+	for name, max := range item.Max {
+		if limit, ok := resources.Limits[name]; !ok || limit.Cmp(max) > 0 {
+			return fmt.Errorf("%s limit must be at most %s", name, max.String())
+		}
+	}
+	for name, ratio := range item.MaxLimitRequestRatio {
+		limit, hasLimit := resources.Limits[name]
+		request, hasRequest := resources.Requests[name]
+		if hasLimit && hasRequest && request.Cmp(minRequestForRatio(name, limit, ratio)) < 0 {
+			return fmt.Errorf("%s limit %s is more than %s times the request %s", name, limit.String(), ratio.String(), request.String())
+		}
+	}
+	return nil
+}
+
+// minRequestForRatio is the smallest request that keeps limit/request within the ratio,
+// cpu is rounded up to the millicore and everything else to a whole unit
+func minRequestForRatio(name corev1.ResourceName, limit, ratio resource.Quantity) resource.Quantity {
+	if name == corev1.ResourceCPU {
+		milli := math.Ceil(float64(limit.MilliValue()) / ratio.AsApproximateFloat64())
+		return *resource.NewMilliQuantity(int64(milli), limit.Format)
+	}
+	value := math.Ceil(float64(limit.Value()) / ratio.AsApproximateFloat64())
+	return *resource.NewQuantity(int64(value), limit.Format)
+}
+
+func validateResources(resources corev1.ResourceRequirements) error {
+	for name, request := range resources.Requests {
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return fmt.Errorf("%s request %s is above the limit %s", name, request.String(), limit.String())
+		}
+	}
+	return nil
+}
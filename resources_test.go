@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func resourceList(cpu, memory string) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	if cpu != "" {
+		list[corev1.ResourceCPU] = resource.MustParse(cpu)
+	}
+	if memory != "" {
+		list[corev1.ResourceMemory] = resource.MustParse(memory)
+	}
+	return list
+}
+
+func containerLimitRange(name string, item corev1.LimitRangeItem) corev1.LimitRange {
+	item.Type = corev1.LimitTypeContainer
+	return corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{item}},
+	}
+}
+
+func TestDefaultSidecarResources(t *testing.T) {
+	resources, err := defaultSidecarResources("10m", "20Mi", "", "50Mi")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := resources.Limits[corev1.ResourceCPU]; ok {
+		t.Error("empty cpu limit should leave it unset")
+	}
+	if resources.Requests.Memory().String() != "20Mi" || resources.Limits.Memory().String() != "50Mi" {
+		t.Errorf("unexpected resources: %+v", resources)
+	}
+
+	if _, err := defaultSidecarResources("10m", "lots", "30m", "50Mi"); err == nil {
+		t.Error("expected an error for an invalid quantity")
+	}
+	if _, err := defaultSidecarResources("10m", "100Mi", "30m", "50Mi"); err == nil {
+		t.Error("expected an error for a request above the limit")
+	}
+}
+
+func TestSidecarResources(t *testing.T) {
+	defaults := corev1.ResourceRequirements{
+		Requests: resourceList("10m", "20Mi"),
+		Limits:   resourceList("30m", "50Mi"),
+	}
+
+	var tests = []struct {
+		scenario    string
+		override    corev1.ResourceRequirements
+		limitRanges []corev1.LimitRange
+		requests    corev1.ResourceList
+		limits      corev1.ResourceList
+		err         string
+	}{
+		{
+			scenario: "defaults",
+			requests: resourceList("10m", "20Mi"),
+			limits:   resourceList("30m", "50Mi"),
+		},
+		{
+			scenario: "binding overrides the memory limit",
+			override: corev1.ResourceRequirements{Limits: resourceList("", "256Mi")},
+			requests: resourceList("10m", "20Mi"),
+			limits:   resourceList("30m", "256Mi"),
+		},
+		{
+			scenario: "request above the default limit raises the limit",
+			override: corev1.ResourceRequirements{Requests: resourceList("", "128Mi")},
+			requests: resourceList("10m", "128Mi"),
+			limits:   resourceList("30m", "128Mi"),
+		},
+		{
+			scenario: "request above the binding's limit",
+			override: corev1.ResourceRequirements{Requests: resourceList("", "128Mi"), Limits: resourceList("", "64Mi")},
+			err:      "memory request 128Mi is above the limit 64Mi",
+		},
+		{
+			scenario: "clamped to the minimum",
+			limitRanges: []corev1.LimitRange{
+				containerLimitRange("min", corev1.LimitRangeItem{Min: resourceList("50m", "64Mi")}),
+			},
+			requests: resourceList("50m", "64Mi"),
+			limits:   resourceList("50m", "64Mi"),
+		},
+		{
+			scenario: "clamped to the maximum",
+			override: corev1.ResourceRequirements{Limits: resourceList("", "1Gi")},
+			limitRanges: []corev1.LimitRange{
+				containerLimitRange("max", corev1.LimitRangeItem{Max: resourceList("", "512Mi")}),
+			},
+			requests: resourceList("10m", "20Mi"),
+			limits:   resourceList("30m", "512Mi"),
+		},
+		{
+			scenario: "request raised to fit the limit request ratio",
+			limitRanges: []corev1.LimitRange{
+				containerLimitRange("ratio", corev1.LimitRangeItem{MaxLimitRequestRatio: resourceList("2", "2")}),
+			},
+			requests: resourceList("15m", "25Mi"),
+			limits:   resourceList("30m", "50Mi"),
+		},
+		{
+			scenario: "pod limits are ignored",
+			limitRanges: []corev1.LimitRange{{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod"},
+				Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{
+					{Type: corev1.LimitTypePod, Max: resourceList("", "10Mi")},
+				}},
+			}},
+			requests: resourceList("10m", "20Mi"),
+			limits:   resourceList("30m", "50Mi"),
+		},
+		{
+			scenario: "limit ranges that can't both be satisfied",
+			limitRanges: []corev1.LimitRange{
+				containerLimitRange("min", corev1.LimitRangeItem{Min: resourceList("", "1Gi")}),
+				containerLimitRange("max", corev1.LimitRangeItem{Max: resourceList("", "512Mi")}),
+			},
+			err: "sidecar resources can't satisfy LimitRange min: memory request must be at least 1Gi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			resources, err := sidecarResources(defaults, tt.override, tt.limitRanges)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for name, expected := range tt.requests {
+				if actual := resources.Requests[name]; actual.Cmp(expected) != 0 {
+					t.Errorf("expected %s request %s, got: %s", name, expected.String(), actual.String())
+				}
+			}
+			for name, expected := range tt.limits {
+				if actual := resources.Limits[name]; actual.Cmp(expected) != 0 {
+					t.Errorf("expected %s limit %s, got: %s", name, expected.String(), actual.String())
+				}
+			}
+		})
+	}
+
+	if defaults.Limits.Memory().String() != "50Mi" {
+		t.Error("defaults should not be modified")
+	}
+}
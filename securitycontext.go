@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podSecurityEnforceLabel is the namespace label Pod Security admission enforces a profile from
+const podSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+
+// restrictedSecurityContext is whether every pod's sidecars get the restricted security context,
+// from --restricted-security-context. Otherwise only pods in namespaces that enforce the restricted
+// profile get it, as sidecar images that need a writable root filesystem or don't set a numeric
+// USER would fail to start.
+var restrictedSecurityContext bool
+
+// enforcesRestricted is whether the namespace enforces the Pod Security restricted profile, which
+// would reject the pod unless its sidecars get the restricted security context
+func (srv webHookServer) enforcesRestricted(namespace string) bool {
+	ns, err := srv.namespaces.Get(namespace)
+	if err != nil {
+		log.Warnf("Error getting namespace %s, not checking whether it enforces the restricted Pod Security profile: %v", namespace, err)
+		return false
+	}
+	return ns.Labels[podSecurityEnforceLabel] == "restricted"
+}
+
+// sidecarSecurityContext is locked down enough for the Pod Security restricted profile. The user
+// and group come from the pod so the app can read the credentials the sidecar writes, falling
+// back to --sidecar-run-as-user, and anything set on the binding takes precedence. Unless restricted
+// the sidecar only gets what the binding sets.
+func sidecarSecurityContext(pod *corev1.Pod, override *corev1.SecurityContext, restricted bool) *corev1.SecurityContext {
+	if !restricted {
+		return override.DeepCopy()
+	}
+
+	runAsNonRoot := true
+	allowPrivilegeEscalation := false
+	readOnlyRootFilesystem := true
+
+	securityContext := &corev1.SecurityContext{
+		RunAsNonRoot:             &runAsNonRoot,
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+
+	podSecurityContext := pod.Spec.SecurityContext
+	if podSecurityContext == nil {
+		podSecurityContext = &corev1.PodSecurityContext{}
+	}
+
+	// root would contradict runAsNonRoot
+	if podSecurityContext.RunAsUser != nil && *podSecurityContext.RunAsUser != 0 {
+		securityContext.RunAsUser = podSecurityContext.RunAsUser
+	} else if sidecarRunAsUser != 0 {
+		runAsUser := sidecarRunAsUser
+		securityContext.RunAsUser = &runAsUser
+	}
+
+	if podSecurityContext.RunAsGroup != nil {
+		securityContext.RunAsGroup = podSecurityContext.RunAsGroup
+	} else if podSecurityContext.FSGroup != nil {
+		securityContext.RunAsGroup = podSecurityContext.FSGroup
+	}
+
+	if override == nil {
+		return securityContext
+	}
+
+	// unmarshalling only replaces the fields the binding sets
+	raw, err := json.Marshal(override)
+	if err != nil {
+		log.Errorf("Error encoding securityContext override: %v", err)
+		return securityContext
+	}
+	if err := json.Unmarshal(raw, securityContext); err != nil {
+		log.Errorf("Error applying securityContext override: %v", err)
+	}
+	return securityContext
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSidecarSecurityContext(t *testing.T) {
+	id := func(i int64) *int64 { return &i }
+	readOnly := false
+
+	sidecarRunAsUser = 65534
+	defer func() { sidecarRunAsUser = 0 }()
+
+	var tests = []struct {
+		scenario   string
+		pod        *corev1.PodSecurityContext
+		override   *corev1.SecurityContext
+		runAsUser  *int64
+		runAsGroup *int64
+		readOnly   bool
+	}{
+		{
+			scenario:  "pod without a security context",
+			runAsUser: id(65534),
+			readOnly:  true,
+		},
+		{
+			scenario:   "inherits the pod's user and group",
+			pod:        &corev1.PodSecurityContext{RunAsUser: id(1000), RunAsGroup: id(3000), FSGroup: id(2000)},
+			runAsUser:  id(1000),
+			runAsGroup: id(3000),
+			readOnly:   true,
+		},
+		{
+			scenario:   "runs as the pod's fsGroup",
+			pod:        &corev1.PodSecurityContext{FSGroup: id(2000)},
+			runAsUser:  id(65534),
+			runAsGroup: id(2000),
+			readOnly:   true,
+		},
+		{
+			scenario:  "doesn't inherit root",
+			pod:       &corev1.PodSecurityContext{RunAsUser: id(0)},
+			runAsUser: id(65534),
+			readOnly:  true,
+		},
+		{
+			scenario:  "binding overrides",
+			pod:       &corev1.PodSecurityContext{RunAsUser: id(1000)},
+			override:  &corev1.SecurityContext{RunAsUser: id(4000), ReadOnlyRootFilesystem: &readOnly},
+			runAsUser: id(4000),
+			readOnly:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{SecurityContext: tt.pod}}
+			sc := sidecarSecurityContext(pod, tt.override, true)
+
+			if !equalID(sc.RunAsUser, tt.runAsUser) || !equalID(sc.RunAsGroup, tt.runAsGroup) {
+				t.Errorf("expected user %v and group %v, got: %v %v", deref(tt.runAsUser), deref(tt.runAsGroup), deref(sc.RunAsUser), deref(sc.RunAsGroup))
+			}
+			if sc.ReadOnlyRootFilesystem == nil || *sc.ReadOnlyRootFilesystem != tt.readOnly {
+				t.Errorf("expected readOnlyRootFilesystem %t", tt.readOnly)
+			}
+
+			// https://kubernetes.io/docs/concepts/security/pod-security-standards/#restricted
+			if sc.RunAsNonRoot == nil || !*sc.RunAsNonRoot {
+				t.Error("should run as non root")
+			}
+			if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+				t.Error("should not allow privilege escalation")
+			}
+			if sc.Capabilities == nil || len(sc.Capabilities.Drop) != 1 || sc.Capabilities.Drop[0] != "ALL" {
+				t.Errorf("should drop all capabilities, got: %+v", sc.Capabilities)
+			}
+			if sc.SeccompProfile == nil || sc.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+				t.Errorf("should use the runtime default seccomp profile, got: %+v", sc.SeccompProfile)
+			}
+		})
+	}
+}
+
+func equalID(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func deref(i *int64) interface{} {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
+
+func TestSidecarSecurityContextDisabled(t *testing.T) {
+	pod := &corev1.Pod{}
+	if sc := sidecarSecurityContext(pod, nil, false); sc != nil {
+		t.Errorf("expected no security context unless restricted, got: %+v", sc)
+	}
+
+	readOnly := true
+	override := &corev1.SecurityContext{ReadOnlyRootFilesystem: &readOnly}
+	sc := sidecarSecurityContext(pod, override, false)
+	if sc == override || sc.ReadOnlyRootFilesystem == nil || !*sc.ReadOnlyRootFilesystem || sc.RunAsNonRoot != nil {
+		t.Errorf("expected a copy of the binding's security context only, got: %+v", sc)
+	}
+}
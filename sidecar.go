@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+)
+
+const sidecarModeAuto = "auto"
+
+// Native sidecars are beta and enabled by default from 1.29, on 1.28 they need the
+// SidecarContainers feature gate so --sidecar-mode=native has to be set explicitly
+var nativeSidecarVersion = version.MajorMinor(1, 29)
+
+// nativeSidecarsEnabled resolves --sidecar-mode, auto checks the API server version
+func nativeSidecarsEnabled(mode string, client discovery.ServerVersionInterface) (bool, error) {
+	switch mode {
+	case v1alpha1.SidecarModeNative:
+		return true, nil
+	case v1alpha1.SidecarModeLegacy:
+		return false, nil
+	}
+
+	info, err := client.ServerVersion()
+	if err != nil {
+		return false, fmt.Errorf("error getting server version: %s", err)
+	}
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return false, fmt.Errorf("error parsing server version %q: %s", info.GitVersion, err)
+	}
+	return serverVersion.AtLeast(nativeSidecarVersion), nil
+}
+
+// useNativeSidecar applies a binding's sidecarMode over the webhook's mode
+func useNativeSidecar(bindingMode string, native bool) bool {
+	switch bindingMode {
+	case v1alpha1.SidecarModeNative:
+		return true
+	case v1alpha1.SidecarModeLegacy:
+		return false
+	}
+	return native
+}
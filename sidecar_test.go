@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNativeSidecarsEnabled(t *testing.T) {
+	tests := []struct {
+		mode          string
+		serverVersion string
+		native        bool
+	}{
+		{mode: "auto", serverVersion: "v1.27.9", native: false},
+		{mode: "auto", serverVersion: "v1.28.4", native: false},
+		{mode: "auto", serverVersion: "v1.29.0", native: true},
+		{mode: "auto", serverVersion: "v1.31.2-eks-7f9249a", native: true},
+		{mode: "native", serverVersion: "v1.27.9", native: true},
+		{mode: "legacy", serverVersion: "v1.31.2", native: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.serverVersion, func(t *testing.T) {
+			client := fake.NewClientset()
+			client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: tt.serverVersion}
+
+			native, err := nativeSidecarsEnabled(tt.mode, client.Discovery())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if native != tt.native {
+				t.Errorf("expected native sidecars %t, got: %t", tt.native, native)
+			}
+		})
+	}
+}
+
+func TestUseNativeSidecar(t *testing.T) {
+	tests := []struct {
+		bindingMode string
+		native      bool
+		expected    bool
+	}{
+		{bindingMode: "", native: true, expected: true},
+		{bindingMode: "", native: false, expected: false},
+		{bindingMode: "legacy", native: true, expected: false},
+		{bindingMode: "native", native: false, expected: true},
+	}
+
+	for _, tt := range tests {
+		if got := useNativeSidecar(tt.bindingMode, tt.native); got != tt.expected {
+			t.Errorf("useNativeSidecar(%q, %t) expected %t, got: %t", tt.bindingMode, tt.native, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// missingTemplatePolicyWarn allows pods without their template, with an admission warning
+	missingTemplatePolicyWarn = "warn"
+	// missingTemplatePolicyDeny rejects pods without their template
+	missingTemplatePolicyDeny = "deny"
+)
+
+// missingTemplates describes the databases whose template can't be found in the pod's vault-template
+// volume. Bindings with their own template volume are skipped, and only ConfigMap volumes are looked into.
+func (srv webHookServer) missingTemplates(pod *corev1.Pod, namespace string, databases []database) []string {
+	needed := []database{}
+	for _, d := range databases {
+		if !d.hasOwnTemplate() {
+			needed = append(needed, d)
+		}
+	}
+	if len(needed) == 0 {
+		return nil
+	}
+
+	var volume *corev1.Volume
+	for i := range pod.Spec.Volumes {
+		if pod.Spec.Volumes[i].Name == defaultTemplateVolumeName {
+			volume = &pod.Spec.Volumes[i]
+		}
+	}
+
+	var configMap *corev1.ConfigMap
+	configMapNotFound := false
+	if volume != nil && volume.ConfigMap != nil {
+		cm, err := srv.configMaps.ConfigMaps(namespace).Get(volume.ConfigMap.Name)
+		switch {
+		case err == nil:
+			configMap = cm
+		case errors.IsNotFound(err):
+			configMapNotFound = true
+		default:
+			// don't hold up admission when we can't tell, the status reconciler will report it
+			log.Warnf("Error getting ConfigMap %s/%s, not checking it has the templates: %v", namespace, volume.ConfigMap.Name, err)
+		}
+	}
+
+	var missing []string
+	for _, d := range needed {
+		key := templateKey(d.database, d.role)
+		switch {
+		case volume == nil:
+			missing = append(missing, fmt.Sprintf("the vault-creds sidecar for %s/%s needs a %s volume with a %s template", d.database, d.role, defaultTemplateVolumeName, key))
+		case configMapNotFound:
+			missing = append(missing, fmt.Sprintf("ConfigMap %s of the %s volume not found, the vault-creds sidecar for %s/%s needs its %s template", volume.ConfigMap.Name, defaultTemplateVolumeName, d.database, d.role, key))
+		case configMap != nil && !configMapHasKey(*configMap, volume.ConfigMap.Items, key):
+			missing = append(missing, fmt.Sprintf("ConfigMap %s of the %s volume has no %s template for the vault-creds sidecar for %s/%s", volume.ConfigMap.Name, defaultTemplateVolumeName, key, d.database, d.role))
+		}
+	}
+	return missing
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// the sidecar writes this file into the vault-creds volume once the credentials are ready
+const completedFile = "completed"
+
+// This handles the admission review sent by k8s for DatabaseCredentialBindings and
+// ClusterDatabaseCredentialBindings, denying bindings that would otherwise only fail
+// once a pod using them is created.
+func (srv webHookServer) validate(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+
+	var errs field.ErrorList
+	switch req.Kind.Kind {
+	case "DatabaseCredentialBinding":
+		var binding v1alpha1.DatabaseCredentialBinding
+		if err := json.Unmarshal(req.Object.Raw, &binding); err != nil {
+			log.Errorf("Could not unmarshal raw object: %v", err)
+			return &admissionv1.AdmissionResponse{
+				Result: &metav1.Status{
+					Message: err.Error(),
+				},
+			}
+		}
+
+		binds, err := srv.bindings.List()
+		if err != nil {
+			return &admissionv1.AdmissionResponse{
+				Result: &metav1.Status{
+					Message: err.Error(),
+				},
+			}
+		}
+
+		// compare against the other bindings in the namespace, on update the cache still holds the old version
+		others := []v1alpha1.DatabaseCredentialBinding{}
+		for _, other := range filterBindings(binds, req.Namespace) {
+			if other.Name != req.Name {
+				others = append(others, other)
+			}
+		}
+		errs = validateBinding(&binding, others)
+	case "ClusterDatabaseCredentialBinding":
+		var clusterBinding v1alpha1.ClusterDatabaseCredentialBinding
+		if err := json.Unmarshal(req.Object.Raw, &clusterBinding); err != nil {
+			log.Errorf("Could not unmarshal raw object: %v", err)
+			return &admissionv1.AdmissionResponse{
+				Result: &metav1.Status{
+					Message: err.Error(),
+				},
+			}
+		}
+
+		// the namespaces it applies to change with their labels, so it isn't checked against their bindings
+		binding := v1alpha1.DatabaseCredentialBinding{ObjectMeta: clusterBinding.ObjectMeta, Spec: clusterBinding.Spec.DatabaseCredentialBindingSpec}
+		errs = validateBinding(&binding, nil)
+	default:
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+
+	if len(errs) != 0 {
+		log.Infof("Denying %s %s: %v", req.Kind.Kind, path.Join(req.Namespace, req.Name), errs.ToAggregate())
+		status := apierrors.NewInvalid(v1alpha1.Kind(req.Kind.Kind), req.Name, errs).Status()
+		return &admissionv1.AdmissionResponse{
+			Result: &status,
+		}
+	}
+
+	return &admissionv1.AdmissionResponse{
+		Allowed: true,
+	}
+}
+
+func validateBinding(binding *v1alpha1.DatabaseCredentialBinding, others []v1alpha1.DatabaseCredentialBinding) field.ErrorList {
+	errs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+	spec := binding.Spec
+
+	// database and role make up the sidecar container names
+	if spec.Database == "" {
+		errs = append(errs, field.Required(specPath.Child("database"), ""))
+	} else {
+		for _, msg := range validation.IsDNS1123Label(strings.Replace(spec.Database, "_", "-", -1)) {
+			errs = append(errs, field.Invalid(specPath.Child("database"), spec.Database, "must be usable in a container name (underscores are allowed): "+msg))
+		}
+	}
+	if spec.Role == "" {
+		errs = append(errs, field.Required(specPath.Child("role"), ""))
+	} else {
+		for _, msg := range validation.IsDNS1123Label(spec.Role) {
+			errs = append(errs, field.Invalid(specPath.Child("role"), spec.Role, "must be usable in a container name: "+msg))
+		}
+	}
+	if len(errs) == 0 {
+		name := database{database: spec.Database, role: spec.Role}.containerName() + "-init"
+		if len(name) > validation.DNS1123LabelMaxLength {
+			errs = append(errs, field.Invalid(specPath.Child("role"), spec.Role,
+				fmt.Sprintf("database and role produce the container name %q which must be no more than %d characters", name, validation.DNS1123LabelMaxLength)))
+		}
+	}
+
+	if spec.ServiceAccount == "" && len(spec.ServiceAccounts) == 0 {
+		errs = append(errs, field.Required(specPath.Child("serviceAccount"), "either serviceAccount or serviceAccounts must be set"))
+	}
+
+	outputPath := bindingOutputPath(spec)
+	if spec.OutputPath != "" && !path.IsAbs(spec.OutputPath) {
+		errs = append(errs, field.Invalid(specPath.Child("outputPath"), spec.OutputPath, "must be an absolute path"))
+	}
+
+	outputFile := bindingOutputFile(spec)
+	if spec.OutputFile != "" {
+		if strings.Contains(spec.OutputFile, "/") || spec.OutputFile == "." || spec.OutputFile == ".." {
+			errs = append(errs, field.Invalid(specPath.Child("outputFile"), spec.OutputFile, "must be a file name, not a path"))
+		} else if spec.OutputFile == completedFile {
+			errs = append(errs, field.Invalid(specPath.Child("outputFile"), spec.OutputFile, "is reserved for the sidecar's completed marker"))
+		}
+	}
+
+	if spec.RenewInterval != nil && spec.RenewInterval.Duration <= 0 {
+		errs = append(errs, field.Invalid(specPath.Child("renewInterval"), spec.RenewInterval.Duration.String(), "must be positive"))
+	}
+	if spec.LeaseDuration != nil && spec.LeaseDuration.Duration <= 0 {
+		errs = append(errs, field.Invalid(specPath.Child("leaseDuration"), spec.LeaseDuration.Duration.String(), "must be positive"))
+	}
+	// the lease has to be renewed before it runs out
+	renewInterval := durationOrDefault(spec.RenewInterval, defaultRenewInterval)
+	leaseDuration := durationOrDefault(spec.LeaseDuration, defaultLeaseDuration)
+	if (spec.RenewInterval != nil || spec.LeaseDuration != nil) && renewInterval > 0 && leaseDuration > 0 && renewInterval >= leaseDuration {
+		if spec.RenewInterval != nil {
+			errs = append(errs, field.Invalid(specPath.Child("renewInterval"), renewInterval.String(), fmt.Sprintf("must be shorter than the lease duration %s", leaseDuration)))
+		} else {
+			errs = append(errs, field.Invalid(specPath.Child("leaseDuration"), leaseDuration.String(), fmt.Sprintf("must be longer than the renew interval %s", renewInterval)))
+		}
+	}
+
+	// inline templates are carried in a pod annotation
+	if len(spec.Template) > apivalidation.TotalAnnotationSizeLimitB {
+		errs = append(errs, field.TooLong(specPath.Child("template"), "", apivalidation.TotalAnnotationSizeLimitB))
+	}
+
+	if spec.TemplateFrom != nil {
+		errs = append(errs, validateTemplateSource(spec, specPath.Child("templateFrom"))...)
+	}
+
+	if spec.VaultConnection != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(spec.VaultConnection) {
+			errs = append(errs, field.Invalid(specPath.Child("vaultConnection"), spec.VaultConnection, msg))
+		}
+	}
+
+	if namespace := strings.Trim(spec.VaultNamespace, "/"); strings.Contains(namespace, "//") || strings.ContainsAny(namespace, " \t\n") {
+		errs = append(errs, field.Invalid(specPath.Child("vaultNamespace"), spec.VaultNamespace, "must be a Vault namespace path like parent/child"))
+	}
+
+	if spec.EnvVar != "" {
+		for _, msg := range validation.IsEnvVarName(spec.EnvVar) {
+			errs = append(errs, field.Invalid(specPath.Child("envVar"), spec.EnvVar, msg))
+		}
+	}
+
+	names := map[string]bool{}
+	for i, name := range spec.Containers {
+		for _, msg := range validation.IsDNS1123Label(name) {
+			errs = append(errs, field.Invalid(specPath.Child("containers").Index(i), name, msg))
+		}
+		if names[name] {
+			errs = append(errs, field.Duplicate(specPath.Child("containers").Index(i), name))
+		}
+		names[name] = true
+	}
+
+	if spec.Volume.SizeLimit != nil && spec.Volume.SizeLimit.Sign() <= 0 {
+		errs = append(errs, field.Invalid(specPath.Child("volume", "sizeLimit"), spec.Volume.SizeLimit.String(), "must be positive"))
+	}
+
+	if err := validateResources(spec.Container.Resources); err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("container", "resources"), spec.Container.Resources, err.Error()))
+	}
+
+	// bindings sharing a service account are injected into the same pods and write into the same volume,
+	// unless one has a volume of its own, then the containers can't mount both at the same path
+	isolated := database{volumeIsolation: spec.Volume.Isolation}.isolated()
+	for _, other := range others {
+		if !shareServiceAccount(spec, other.Spec) {
+			continue
+		}
+		// the same database and role is de-duplicated when injected
+		if other.Spec.Database == spec.Database && other.Spec.Role == spec.Role {
+			continue
+		}
+
+		otherPath := bindingOutputPath(other.Spec)
+		if outputPath != otherPath && (isSubPath(outputPath, otherPath) || isSubPath(otherPath, outputPath)) {
+			errs = append(errs, field.Invalid(specPath.Child("outputPath"), outputPath,
+				fmt.Sprintf("overlaps with outputPath %s of DatabaseCredentialBinding %s", otherPath, other.Name)))
+		}
+		otherIsolated := database{volumeIsolation: other.Spec.Volume.Isolation}.isolated()
+		if outputPath == otherPath && (isolated || otherIsolated) {
+			errs = append(errs, field.Invalid(specPath.Child("outputPath"), outputPath,
+				fmt.Sprintf("is also mounted by DatabaseCredentialBinding %s, bindings with a volume of their own need an outputPath of their own", other.Name)))
+		}
+		if bindingOutputFile(other.Spec) == outputFile {
+			errs = append(errs, field.Invalid(specPath.Child("outputFile"), outputFile,
+				fmt.Sprintf("is also written by DatabaseCredentialBinding %s for the same service account", other.Name)))
+		}
+	}
+
+	return errs
+}
+
+func validateTemplateSource(spec v1alpha1.DatabaseCredentialBindingSpec, fldPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	source := spec.TemplateFrom
+
+	if spec.Template != "" {
+		errs = append(errs, field.Forbidden(fldPath, "may not be set together with template"))
+	}
+
+	switch {
+	case source.ConfigMapKeyRef != nil && source.SecretKeyRef != nil:
+		errs = append(errs, field.Invalid(fldPath, "", "only one of configMapKeyRef or secretKeyRef may be set"))
+	case source.ConfigMapKeyRef != nil:
+		errs = append(errs, validateKeyRef(source.ConfigMapKeyRef.Name, source.ConfigMapKeyRef.Key, fldPath.Child("configMapKeyRef"))...)
+	case source.SecretKeyRef != nil:
+		errs = append(errs, validateKeyRef(source.SecretKeyRef.Name, source.SecretKeyRef.Key, fldPath.Child("secretKeyRef"))...)
+	default:
+		errs = append(errs, field.Required(fldPath, "one of configMapKeyRef or secretKeyRef must be set"))
+	}
+
+	return errs
+}
+
+func validateKeyRef(name, key string, fldPath *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if name == "" {
+		errs = append(errs, field.Required(fldPath.Child("name"), ""))
+	}
+	if key == "" {
+		errs = append(errs, field.Required(fldPath.Child("key"), ""))
+	} else {
+		for _, msg := range validation.IsConfigMapKey(key) {
+			errs = append(errs, field.Invalid(fldPath.Child("key"), key, msg))
+		}
+	}
+	return errs
+}
+
+func bindingOutputPath(spec v1alpha1.DatabaseCredentialBindingSpec) string {
+	if spec.OutputPath == "" {
+		return database{database: spec.Database, role: spec.Role, volumeIsolation: spec.Volume.Isolation}.defaultOutputPathFor()
+	}
+	return path.Clean(spec.OutputPath)
+}
+
+func bindingOutputFile(spec v1alpha1.DatabaseCredentialBindingSpec) string {
+	if spec.OutputFile == "" {
+		return fmt.Sprintf("%s-%s", spec.Database, spec.Role)
+	}
+	return spec.OutputFile
+}
+
+func shareServiceAccount(a, b v1alpha1.DatabaseCredentialBindingSpec) bool {
+	if a.ServiceAccount != "" && b.HasServiceAccount(a.ServiceAccount) {
+		return true
+	}
+	for _, serviceAccount := range a.ServiceAccounts {
+		if b.HasServiceAccount(serviceAccount) {
+			return true
+		}
+	}
+	return false
+}
+
+// is p a directory below parent
+func isSubPath(p, parent string) bool {
+	return strings.HasPrefix(p, strings.TrimSuffix(parent, "/")+"/")
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestValidateBinding(t *testing.T) {
+	defaultRenewInterval, defaultLeaseDuration = time.Hour, 12*time.Hour
+	defer func() { defaultRenewInterval, defaultLeaseDuration = 0, 0 }()
+
+	others := []v1alpha1.DatabaseCredentialBinding{
+		v1alpha1.DatabaseCredentialBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "existing"},
+			Spec: v1alpha1.DatabaseCredentialBindingSpec{
+				ServiceAccount: "foo",
+				Database:       "mydb",
+				Role:           "readonly",
+				OutputPath:     "/etc/database",
+				OutputFile:     "creds",
+			},
+		},
+	}
+
+	var tests = []struct {
+		scenario string
+		spec     v1alpha1.DatabaseCredentialBindingSpec
+		fields   []string
+	}{
+		{
+			scenario: "valid binding",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "my_db", Role: "admin"},
+		},
+		{
+			scenario: "same database and role as another binding",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "readonly", OutputFile: "creds"},
+		},
+		{
+			scenario: "role with invalid characters",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "Read.Only"},
+			fields:   []string{"spec.role"},
+		},
+		{
+			scenario: "missing database and service account",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{Role: "readonly"},
+			fields:   []string{"spec.database", "spec.serviceAccount"},
+		},
+		{
+			scenario: "container name too long",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "a-really-long-database-name", Role: "with-an-equally-long-role"},
+			fields:   []string{"spec.role"},
+		},
+		{
+			scenario: "relative output path",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", OutputPath: "etc/database"},
+			fields:   []string{"spec.outputPath"},
+		},
+		{
+			scenario: "output path nested in another binding's path",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", OutputPath: "/etc/database/admin"},
+			fields:   []string{"spec.outputPath"},
+		},
+		{
+			scenario: "output path nested in another service account's binding",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "bah", Database: "mydb", Role: "admin", OutputPath: "/etc/database/admin"},
+		},
+		{
+			scenario: "output file shared with another binding for the service account",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccounts: []string{"bah", "foo"}, Database: "mydb", Role: "admin", OutputFile: "creds"},
+			fields:   []string{"spec.outputFile"},
+		},
+		{
+			scenario: "own volume at another binding's output path",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", OutputPath: "/etc/database", Volume: v1alpha1.CredentialsVolume{Isolation: v1alpha1.VolumeIsolationBinding}},
+			fields:   []string{"spec.outputPath"},
+		},
+		{
+			scenario: "own volume by default nested in another binding's output path",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", Volume: v1alpha1.CredentialsVolume{Isolation: v1alpha1.VolumeIsolationBinding}},
+			fields:   []string{"spec.outputPath"},
+		},
+		{
+			scenario: "own volume by default for another service account",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "bah", Database: "mydb", Role: "admin", Volume: v1alpha1.CredentialsVolume{Isolation: v1alpha1.VolumeIsolationBinding}},
+		},
+		{
+			scenario: "own volume at its own output path",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", OutputPath: "/etc/admin", Volume: v1alpha1.CredentialsVolume{Isolation: v1alpha1.VolumeIsolationBinding}},
+		},
+		{
+			scenario: "output file that is a path",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", OutputFile: "../creds"},
+			fields:   []string{"spec.outputFile"},
+		},
+		{
+			scenario: "output file clashing with the completed marker",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", OutputFile: "completed"},
+			fields:   []string{"spec.outputFile"},
+		},
+		{
+			scenario: "request above the limit",
+			spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", Container: v1alpha1.Container{
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("100Mi")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("50Mi")},
+				},
+			}},
+			fields: []string{"spec.container.resources"},
+		},
+		{
+			scenario: "renew interval longer than the lease",
+			spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin",
+				RenewInterval: &metav1.Duration{Duration: time.Hour}, LeaseDuration: &metav1.Duration{Duration: 15 * time.Minute}},
+			fields: []string{"spec.renewInterval"},
+		},
+		{
+			scenario: "lease shorter than the default renew interval",
+			spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin",
+				LeaseDuration: &metav1.Duration{Duration: 15 * time.Minute}},
+			fields: []string{"spec.leaseDuration"},
+		},
+		{
+			scenario: "short lease with a shorter renew interval",
+			spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin",
+				RenewInterval: &metav1.Duration{Duration: 5 * time.Minute}, LeaseDuration: &metav1.Duration{Duration: 15 * time.Minute}},
+		},
+		{
+			scenario: "template too large for an annotation",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", Template: strings.Repeat("x", 300*1024)},
+			fields:   []string{"spec.template"},
+		},
+		{
+			scenario: "vault connection",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", VaultConnection: "vault-eu-west-1"},
+		},
+		{
+			scenario: "vault namespace",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", VaultNamespace: "platform/team-a"},
+		},
+		{
+			scenario: "invalid vault namespace",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", VaultNamespace: "platform//team a"},
+			fields:   []string{"spec.vaultNamespace"},
+		},
+		{
+			scenario: "env var",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", EnvVar: "DATABASE_CREDENTIALS"},
+		},
+		{
+			scenario: "invalid env var",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", EnvVar: "DATABASE=CREDENTIALS"},
+			fields:   []string{"spec.envVar"},
+		},
+		{
+			scenario: "containers",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", Containers: []string{"app", "worker"}},
+		},
+		{
+			scenario: "invalid and duplicate containers",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", Containers: []string{"App", "worker", "worker"}},
+			fields:   []string{"spec.containers[0]", "spec.containers[2]"},
+		},
+		{
+			scenario: "volume size limit",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", Volume: v1alpha1.CredentialsVolume{SizeLimit: resource.NewQuantity(0, resource.BinarySI)}},
+			fields:   []string{"spec.volume.sizeLimit"},
+		},
+		{
+			scenario: "invalid vault connection name",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", VaultConnection: "Vault_EU"},
+			fields:   []string{"spec.vaultConnection"},
+		},
+		{
+			scenario: "template from a secret",
+			spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", TemplateFrom: &v1alpha1.TemplateSource{
+				SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "templates"}, Key: "admin.tmpl"},
+			}},
+		},
+		{
+			scenario: "template from both a config map and a secret",
+			spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", TemplateFrom: &v1alpha1.TemplateSource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "templates"}, Key: "admin"},
+				SecretKeyRef:    &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "templates"}, Key: "admin"},
+			}},
+			fields: []string{"spec.templateFrom"},
+		},
+		{
+			scenario: "template from a config map without a key, and an inline template",
+			spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", Template: "{{ .Username }}", TemplateFrom: &v1alpha1.TemplateSource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "templates"}},
+			}},
+			fields: []string{"spec.templateFrom", "spec.templateFrom.configMapKeyRef.key"},
+		},
+		{
+			scenario: "empty template source",
+			spec:     v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin", TemplateFrom: &v1alpha1.TemplateSource{}},
+			fields:   []string{"spec.templateFrom"},
+		},
+		{
+			scenario: "negative renew interval",
+			spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "admin",
+				RenewInterval: &metav1.Duration{Duration: -time.Minute}},
+			fields: []string{"spec.renewInterval"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			binding := &v1alpha1.DatabaseCredentialBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "new"},
+				Spec:       tt.spec,
+			}
+			errs := validateBinding(binding, others)
+			if len(errs) != len(tt.fields) {
+				t.Fatalf("expected errors for %v, got: %v", tt.fields, errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.fields[i] {
+					t.Errorf("expected errors for %v, got: %v", tt.fields, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	existing := v1alpha1.DatabaseCredentialBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "foo"},
+		Spec:       v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "readonly", OutputFile: "creds"},
+	}
+	srv := newTestServer(t, existing)
+
+	request := func(binding v1alpha1.DatabaseCredentialBinding, operation admissionv1.Operation) *admissionv1.AdmissionRequest {
+		raw, _ := json.Marshal(binding)
+		return &admissionv1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Group: "vaultwebhook.uswitch.com", Version: "v1alpha1", Kind: "DatabaseCredentialBinding"},
+			Name:      binding.Name,
+			Namespace: binding.Namespace,
+			Operation: operation,
+			Object:    runtime.RawExtension{Raw: raw},
+		}
+	}
+
+	// updating a binding shouldn't conflict with its previous self
+	updated := existing
+	updated.Spec.Role = "readwrite"
+	if resp := srv.validate(request(updated, admissionv1.Update)); !resp.Allowed {
+		t.Errorf("update should be allowed, got: %+v", resp.Result)
+	}
+
+	clashing := existing
+	clashing.Name = "clashing"
+	clashing.Spec.Role = "readwrite"
+	resp := srv.validate(request(clashing, admissionv1.Create))
+	if resp.Allowed {
+		t.Fatal("binding sharing an output file should be denied")
+	}
+	if resp.Result.Details == nil || len(resp.Result.Details.Causes) != 1 || resp.Result.Details.Causes[0].Field != "spec.outputFile" {
+		t.Errorf("expected a spec.outputFile cause, got: %+v", resp.Result)
+	}
+
+	if resp := srv.validate(request(clashing, admissionv1.Delete)); !resp.Allowed {
+		t.Errorf("delete should be allowed, got: %+v", resp.Result)
+	}
+}
+
+func TestValidateClusterBinding(t *testing.T) {
+	srv := newTestServer(t, v1alpha1.DatabaseCredentialBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "foo"},
+		Spec:       v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "readonly", OutputFile: "creds"},
+	})
+
+	request := func(spec v1alpha1.DatabaseCredentialBindingSpec) *admissionv1.AdmissionRequest {
+		raw, _ := json.Marshal(v1alpha1.ClusterDatabaseCredentialBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "analytics"},
+			Spec: v1alpha1.ClusterDatabaseCredentialBindingSpec{
+				DatabaseCredentialBindingSpec: spec,
+				NamespaceSelector:             &metav1.LabelSelector{MatchLabels: map[string]string{"team": "data"}},
+			},
+		})
+		return &admissionv1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Group: "vaultwebhook.uswitch.com", Version: "v1alpha1", Kind: "ClusterDatabaseCredentialBinding"},
+			Name:      "analytics",
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}
+	}
+
+	// clashing with a namespace's binding isn't checked, the namespaces it applies to change with their labels
+	if resp := srv.validate(request(v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "analytics", Role: "readonly", OutputFile: "creds"})); !resp.Allowed {
+		t.Errorf("cluster binding should be allowed, got: %+v", resp.Result)
+	}
+
+	resp := srv.validate(request(v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "analytics", Role: "Read_Only", OutputPath: "etc/analytics"}))
+	if resp.Allowed {
+		t.Fatal("cluster binding with an invalid role and outputPath should be denied")
+	}
+	if resp.Result.Details == nil || resp.Result.Details.Kind != "ClusterDatabaseCredentialBinding" || len(resp.Result.Details.Causes) != 2 {
+		t.Errorf("expected spec.role and spec.outputPath causes on the cluster binding, got: %+v", resp.Result)
+	}
+}
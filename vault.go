@@ -3,161 +3,364 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"path"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
 )
 
+const (
+	// injectedAnnotation records the vault-creds containers the webhook has added to a pod
+	injectedAnnotation = "vault-webhook.uswitch.com/injected"
+	// templateAnnotationPrefix is followed by the template key, the annotation holds a binding's inline template
+	templateAnnotationPrefix  = "vault-webhook.uswitch.com/template-"
+	credsVolumeName           = "vault-creds"
+	defaultTemplateVolumeName = "vault-template"
+)
+
+// createPatch only patches in what the pod is missing, so a pod that has already been
+// mutated (reinvocation, re-created from a mutated spec, a second webhook pass) gets
+// an empty patch rather than duplicate containers and volumes. The patch only adds to
+// the pod so changes made by webhooks that ran before us are left alone.
 func createPatch(pod *corev1.Pod, namespace string, databases []database) ([]byte, error) {
+	injected := webhookContainers(pod, databases)
+	databases = missingDatabases(pod, databases)
+	if len(databases) == 0 {
+		return nil, nil
+	}
+
 	patch := []patchOperation{}
-	patch = append(patch, addVolume(pod)...)
-	pod.Spec.Containers = addVolumeMount(pod.Spec.Containers, databases)
-	if len(pod.Spec.InitContainers) != 0 {
-		pod.Spec.InitContainers = addVolumeMount(pod.Spec.InitContainers, databases)
+	for _, volume := range credsVolumes(databases) {
+		if !hasVolume(pod, volume.Name) {
+			patch = append(patch, addVolumePatch(pod, volume)...)
+		}
+	}
+	// a pod allowed without its vault-template volume gets an empty one, the API server would reject
+	// the sidecar's mount otherwise and the sidecar's logs say which template is missing
+	if usesTemplateVolume(databases) && !hasVolume(pod, defaultTemplateVolumeName) {
+		patch = append(patch, addVolumePatch(pod, corev1.Volume{
+			Name:         defaultTemplateVolumeName,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})...)
+	}
+	annotations := map[string]string{}
+	for _, d := range databases {
+		provider := d.sidecarProvider()
+		for _, volume := range provider.Volumes(d) {
+			if !hasVolume(pod, volume.Name) {
+				patch = append(patch, addVolumePatch(pod, volume)...)
+			}
+		}
+		for name, value := range provider.Annotations(d) {
+			annotations[name] = value
+		}
 	}
+	// mounts are patched by index, so this has to happen before addVault inserts init containers
+	patch = append(patch, addVolumeMountPatch(pod, pod.Spec.Containers, false, injected, "/spec/containers", databases)...)
+	pod.Spec.Containers = addVolumeMount(pod, pod.Spec.Containers, false, injected, databases)
+	patch = append(patch, addVolumeMountPatch(pod, pod.Spec.InitContainers, true, injected, "/spec/initContainers", databases)...)
+	pod.Spec.InitContainers = addVolumeMount(pod, pod.Spec.InitContainers, true, injected, databases)
+	patch = append(patch, addEnvPatch(pod.Spec.Containers, false, injected, "/spec/containers", databases)...)
+	pod.Spec.Containers = addEnv(pod.Spec.Containers, false, injected, databases)
+	patch = append(patch, addEnvPatch(pod.Spec.InitContainers, true, injected, "/spec/initContainers", databases)...)
+	pod.Spec.InitContainers = addEnv(pod.Spec.InitContainers, true, injected, databases)
 	patch = append(patch, addVault(pod, namespace, databases)...)
+	annotations[injectedAnnotation] = injectedAnnotationValue(pod, databases)
+	patch = append(patch, addAnnotations(pod, annotations)...)
 	return json.Marshal(patch)
 }
 
-func addVault(pod *corev1.Pod, namespace string, databases []database) (patch []patchOperation) {
-	initContainers := []corev1.Container{}
-	for _, databaseInfo := range databases {
+// The name of the vault-creds sidecar for a database, the init container is suffixed with -init
+func (d database) containerName() string {
+	return fmt.Sprintf("vault-creds-%s-%s", strings.Replace(d.database, "_", "-", -1), d.role)
+}
+
+// The key in the vault-template volume holding the template for a database and role
+func templateKey(database, role string) string {
+	return fmt.Sprintf("%s-%s", database, role)
+}
 
-		vaultContainerSpec := databaseInfo.vaultContainer
+// The volume a binding's own template is projected into, it takes the place of vault-template for the database's sidecar
+func (d database) templateVolumeName() string {
+	return "vault-template-" + strings.TrimPrefix(d.containerName(), "vault-creds-")
+}
 
-		database := databaseInfo.database
-		role := databaseInfo.role
-		serviceAccount := pod.Spec.ServiceAccountName
+// hasOwnTemplate is true when the binding sets template or templateFrom rather than relying on the vault-template volume
+func (d database) hasOwnTemplate() bool {
+	return d.template != "" || d.templateFrom != nil
+}
 
-		authRole := fmt.Sprintf("%s_%s_%s", database, namespace, serviceAccount)
-		containerName := fmt.Sprintf("vault-creds-%s-%s", strings.Replace(database, "_", "-", -1), role)
-		secretPath := fmt.Sprintf(secretPathFormat, database, role)
-		templatePath := fmt.Sprintf("/creds/template/%s-%s", database, role)
-		var outputPath string
+// The pod annotation carrying an inline template
+func templateAnnotation(d database) string {
+	return templateAnnotationPrefix + templateKey(d.database, d.role)
+}
 
-		if databaseInfo.outputFile == "" {
-			outputPath = fmt.Sprintf("/creds/output/%s-%s", database, role)
-		} else {
-			outputPath = fmt.Sprintf("/creds/output/%s", databaseInfo.outputFile)
+// templateVolume projects the binding's template into a file named after the template key, from the
+// template annotation for an inline template or from the ConfigMap or Secret key in templateFrom
+func templateVolume(d database) corev1.Volume {
+	key := templateKey(d.database, d.role)
+	var source corev1.VolumeProjection
+
+	switch {
+	case d.template != "":
+		source.DownwardAPI = &corev1.DownwardAPIProjection{
+			Items: []corev1.DownwardAPIVolumeFile{
+				{
+					Path: key,
+					FieldRef: &corev1.ObjectFieldSelector{
+						FieldPath: fmt.Sprintf("metadata.annotations['%s']", templateAnnotation(d)),
+					},
+				},
+			},
+		}
+	case d.templateFrom.ConfigMapKeyRef != nil:
+		ref := d.templateFrom.ConfigMapKeyRef
+		source.ConfigMap = &corev1.ConfigMapProjection{
+			LocalObjectReference: ref.LocalObjectReference,
+			Items:                []corev1.KeyToPath{{Key: ref.Key, Path: key}},
+			Optional:             ref.Optional,
 		}
+	case d.templateFrom.SecretKeyRef != nil:
+		ref := d.templateFrom.SecretKeyRef
+		source.Secret = &corev1.SecretProjection{
+			LocalObjectReference: ref.LocalObjectReference,
+			Items:                []corev1.KeyToPath{{Key: ref.Key, Path: key}},
+			Optional:             ref.Optional,
+		}
+	}
 
-		requests := corev1.ResourceList{
-			"cpu":    resource.MustParse("10m"),
-			"memory": resource.MustParse("20Mi"),
+	return corev1.Volume{
+		Name: d.templateVolumeName(),
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{source},
+			},
+		},
+	}
+}
+
+// usesTemplateVolume is whether any of the databases' sidecars read their template from vault-template
+func usesTemplateVolume(databases []database) bool {
+	for _, d := range databases {
+		if !d.hasOwnTemplate() {
+			return true
 		}
+	}
+	return false
+}
 
-		limits := corev1.ResourceList{
-			"cpu":    resource.MustParse("30m"),
-			"memory": resource.MustParse("50Mi"),
+// The volume the sidecar reads its template from
+func (d database) sidecarTemplateVolume() string {
+	if d.hasOwnTemplate() {
+		return d.templateVolumeName()
+	}
+	return defaultTemplateVolumeName
+}
+
+// missingDatabases drops the databases whose sidecar and init container, if they have one, are both already in the pod
+func missingDatabases(pod *corev1.Pod, databases []database) []database {
+	missing := []database{}
+	for _, d := range databases {
+		hasInit := d.sidecarProvider().NeedsNativeSidecar() || hasContainer(pod.Spec.InitContainers, d.containerName()+"-init")
+		if hasSidecar(pod, d.containerName()) && hasInit {
+			continue
 		}
+		missing = append(missing, d)
+	}
+	return missing
+}
 
-		vaultContainer := corev1.Container{
-			Image:           sidecarImage,
-			ImagePullPolicy: "Always",
-			Resources: corev1.ResourceRequirements{
-				Requests: requests,
-				Limits:   limits,
-			},
-			Name: containerName,
-			Args: []string{
-				"--vault-addr=" + vaultAddr,
-				"--gateway-addr=" + gatewayAddr,
-				"--ca-cert=" + vaultCaPath,
-				"--secret-path=" + secretPath,
-				"--login-path=" + loginPath,
-				"--auth-role=" + authRole,
-				"--template=" + templatePath,
-				"--out=" + outputPath,
-				"--completed-path=/creds/output/completed",
-				"--renew-interval=1h",
-				"--lease-duration=12h",
-				"--json-log",
-			},
-			Env: []corev1.EnvVar{
-				corev1.EnvVar{
-					Name: "POD_NAME",
-					ValueFrom: &corev1.EnvVarSource{
-						FieldRef: &corev1.ObjectFieldSelector{
-							FieldPath: "metadata.name",
-						},
-					},
-				},
-				corev1.EnvVar{
-					Name: "NAMESPACE",
-					ValueFrom: &corev1.EnvVarSource{
-						FieldRef: &corev1.ObjectFieldSelector{
-							FieldPath: "metadata.namespace",
-						},
-					},
-				},
-			},
-			VolumeMounts: []corev1.VolumeMount{
-				corev1.VolumeMount{
-					Name:      "vault-template",
-					MountPath: "/creds/template",
-				},
-				corev1.VolumeMount{
-					Name:      "vault-creds",
-					MountPath: "/creds/output",
-				},
-			},
+func hasContainer(containers []corev1.Container, name string) bool {
+	for _, c := range containers {
+		if c.Name == name {
+			return true
 		}
+	}
+	return false
+}
+
+// hasSidecar checks for the sidecar as either a regular container or a native sidecar
+func hasSidecar(pod *corev1.Pod, name string) bool {
+	return hasContainer(pod.Spec.Containers, name) || hasContainer(pod.Spec.InitContainers, name)
+}
+
+func hasVolume(pod *corev1.Pod, name string) bool {
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// injectedContainers returns the sidecar names recorded in the injected annotation
+func injectedContainers(pod *corev1.Pod) []string {
+	value, ok := pod.ObjectMeta.Annotations[injectedAnnotation]
+	if !ok || value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// webhookContainers are the sidecars and init containers the webhook has added to the pod, going by the
+// injected annotation and the databases' container names, so they aren't given each other's credentials
+func webhookContainers(pod *corev1.Pod, databases []database) map[string]bool {
+	names := injectedContainers(pod)
+	for _, d := range databases {
+		names = append(names, d.containerName())
+	}
+	containers := map[string]bool{}
+	for _, name := range names {
+		containers[name] = true
+		containers[name+"-init"] = true
+	}
+	return containers
+}
 
-		initContainer := vaultContainer
+// injectedAnnotationValue merges the databases into the injected annotation. The names
+// are sorted so the same set of containers always produces the same annotation.
+func injectedAnnotationValue(pod *corev1.Pod, databases []database) string {
+	names := injectedContainers(pod)
+	for _, d := range databases {
+		names = appendStringIfMissing(names, d.containerName())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// addAnnotations sets the annotations, replacing any existing values
+func addAnnotations(pod *corev1.Pod, annotations map[string]string) (patch []patchOperation) {
+	if pod.ObjectMeta.Annotations == nil {
+		pod.ObjectMeta.Annotations = annotations
+		return append(patch, patchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: annotations,
+		})
+	}
+
+	keys := []string{}
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		pod.ObjectMeta.Annotations[key] = annotations[key]
+		patch = append(patch, patchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations/" + escapeJSONPointer(key),
+			Value: annotations[key],
+		})
+	}
+	return patch
+}
+
+func appendStringIfMissing(slice []string, s string) []string {
+	for _, ele := range slice {
+		if ele == s {
+			return slice
+		}
+	}
+	return append(slice, s)
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6901#section-3
+func escapeJSONPointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
+
+func addVault(pod *corev1.Pod, namespace string, databases []database) (patch []patchOperation) {
+	initContainers := []corev1.Container{}
+	for _, databaseInfo := range databases {
+		initContainer, vaultContainer := databaseInfo.sidecarProvider().Containers(pod, databaseInfo)
+
+		vaultContainer.Name = databaseInfo.containerName()
+		vaultContainer.Resources = databaseInfo.resources
+		vaultContainer.SecurityContext = sidecarSecurityContext(pod, databaseInfo.vaultContainer.SecurityContext, databaseInfo.restricted)
 
 		// Configure Lifecycle Hooks if spec exists
-		vaultContainer = addLifecycleHook(vaultContainer, vaultContainerSpec)
+		vaultContainer = addLifecycleHook(vaultContainer, databaseInfo.vaultContainer)
+
+		if initContainer != nil {
+			initContainer.Name = vaultContainer.Name + "-init"
+			initContainer.Resources = *databaseInfo.resources.DeepCopy()
+			initContainer.SecurityContext = vaultContainer.SecurityContext.DeepCopy()
+			if !hasContainer(pod.Spec.InitContainers, initContainer.Name) {
+				initContainers = append(initContainers, *initContainer)
+			}
+		}
 
-		jobLikeOwnerReferencesKinds := map[string]bool{"Job": true, "Workflow": true}
-		if len(pod.ObjectMeta.OwnerReferences) != 0 {
-			ownerKind := pod.ObjectMeta.OwnerReferences[0].Kind
-			if _, ok := jobLikeOwnerReferencesKinds[ownerKind]; ok {
-				vaultContainer.Args = append(vaultContainer.Args, "--job")
+		// A native sidecar is stopped by the kubelet once the pod's containers are done,
+		// so it runs straight after the init container
+		if databaseInfo.nativeSidecar {
+			restartPolicy := corev1.ContainerRestartPolicyAlways
+			vaultContainer.RestartPolicy = &restartPolicy
+			if !hasSidecar(pod, vaultContainer.Name) {
+				initContainers = append(initContainers, vaultContainer)
 			}
+			continue
 		}
 
 		// Append the new Vault container spec into the Pod Spec generated by the client Deployment/Daemonset/etc
-		pod.Spec.Containers = append(pod.Spec.Containers, vaultContainer)
-
-		initContainer.Args = append(initContainer.Args, "--init")
-		initContainer.Name = initContainer.Name + "-init"
-		initContainers = append(initContainers, initContainer)
+		if !hasSidecar(pod, vaultContainer.Name) {
+			pod.Spec.Containers = append(pod.Spec.Containers, vaultContainer)
+			patch = append(patch, patchOperation{
+				Op:    "add",
+				Path:  "/spec/containers/-",
+				Value: vaultContainer,
+			})
+		}
 	}
 
-	var initOp string
-	if len(pod.Spec.InitContainers) != 0 {
-		initContainers = append(initContainers, pod.Spec.InitContainers...)
-		initOp = "replace"
-	} else {
-		initOp = "add"
+	if len(initContainers) == 0 {
+		return patch
 	}
 
-	patch = append(patch, []patchOperation{
-		patchOperation{
-			Op:    "replace",
-			Path:  "/spec/containers",
-			Value: pod.Spec.Containers,
-		},
-		patchOperation{
-			Op:    initOp,
+	// The init containers go before the pod's own so credentials are there for them too
+	if len(pod.Spec.InitContainers) == 0 {
+		patch = append(patch, patchOperation{
+			Op:    "add",
 			Path:  "/spec/initContainers",
 			Value: initContainers,
-		}}...)
+		})
+	} else {
+		for i, initContainer := range initContainers {
+			patch = append(patch, patchOperation{
+				Op:    "add",
+				Path:  fmt.Sprintf("/spec/initContainers/%d", i),
+				Value: initContainer,
+			})
+		}
+	}
+	pod.Spec.InitContainers = append(initContainers, pod.Spec.InitContainers...)
 
 	return patch
 }
 
-func addVolume(pod *corev1.Pod) (patch []patchOperation) {
+var jobLikeOwnerReferencesKinds = map[string]bool{"Job": true, "Workflow": true}
 
-	volume := corev1.Volume{
-		Name: "vault-creds",
-		VolumeSource: corev1.VolumeSource{
-			EmptyDir: &corev1.EmptyDirVolumeSource{},
-		},
+// isJobLike is true for pods that run to completion, going by their owner
+func isJobLike(pod *corev1.Pod) bool {
+	if len(pod.ObjectMeta.OwnerReferences) == 0 {
+		return false
 	}
+	return jobLikeOwnerReferencesKinds[pod.ObjectMeta.OwnerReferences[0].Kind]
+}
 
+// capLeaseDuration keeps the lease within the pod's deadline, there's no point in
+// credentials outliving a job that will have been killed
+func capLeaseDuration(leaseDuration, deadline time.Duration) time.Duration {
+	if deadline > 0 && deadline < leaseDuration {
+		return deadline
+	}
+	return leaseDuration
+}
+
+// addVolumePatch adds the volume to the pod as well as the patch, so any further volumes are appended after it
+func addVolumePatch(pod *corev1.Pod, volume corev1.Volume) (patch []patchOperation) {
 	path := "/spec/volumes"
 	var value interface{}
 
@@ -173,19 +376,25 @@ func addVolume(pod *corev1.Pod) (patch []patchOperation) {
 		Path:  path,
 		Value: value,
 	})
+	pod.Spec.Volumes = append(pod.Spec.Volumes, volume)
 
 	return patch
 }
 
-func addVolumeMount(containers []corev1.Container, databases []database) []corev1.Container {
+func addVolumeMount(pod *corev1.Pod, containers []corev1.Container, initContainers bool, injected map[string]bool, databases []database) []corev1.Container {
 
 	modifiedContainers := []corev1.Container{}
 
 	for _, container := range containers {
 		for _, database := range databases {
+			if !database.mountsInto(container, initContainers, injected) {
+				continue
+			}
+			// only the sidecar writes the credentials, a --job sidecar needs the completed marker from the pod's containers though
 			volumeMount := corev1.VolumeMount{
-				Name:      "vault-creds",
+				Name:      database.credsVolumeName(),
 				MountPath: database.outputPath,
+				ReadOnly:  !database.waitsForCompletion(pod),
 			}
 			//we don't want to mount the same path twice
 			container.VolumeMounts = appendVolumeMountIfMissing(container.VolumeMounts, volumeMount)
@@ -196,9 +405,146 @@ func addVolumeMount(containers []corev1.Container, databases []database) []corev
 	return modifiedContainers
 }
 
+// addVolumeMountPatch adds the mounts addVolumeMount would add to each container one at a time,
+// path is the JSON pointer to the containers in the pod
+func addVolumeMountPatch(pod *corev1.Pod, containers []corev1.Container, initContainers bool, injected map[string]bool, path string, databases []database) (patch []patchOperation) {
+	modifiedContainers := addVolumeMount(pod, containers, initContainers, injected, databases)
+
+	for i, container := range containers {
+		newMounts := modifiedContainers[i].VolumeMounts[len(container.VolumeMounts):]
+		if len(newMounts) == 0 {
+			continue
+		}
+
+		if len(container.VolumeMounts) == 0 {
+			patch = append(patch, patchOperation{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/%d/volumeMounts", path, i),
+				Value: newMounts,
+			})
+			continue
+		}
+		for _, volumeMount := range newMounts {
+			patch = append(patch, patchOperation{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/%d/volumeMounts/-", path, i),
+				Value: volumeMount,
+			})
+		}
+	}
+
+	return patch
+}
+
+// mountsInto is whether the container gets the credentials, initContainer is true for the pod's
+// init containers. Native sidecars run alongside the pod's containers so are targeted like them,
+// except for the injected ones, which only get the volumes their provider mounts.
+func (d database) mountsInto(container corev1.Container, initContainer bool, injected map[string]bool) bool {
+	if injected[container.Name] {
+		return false
+	}
+	if initContainer && !isNativeSidecar(container) {
+		return !d.skipInitContainers
+	}
+	if len(d.containers) == 0 {
+		return true
+	}
+	for _, name := range d.containers {
+		if name == container.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func isNativeSidecar(container corev1.Container) bool {
+	return container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways
+}
+
+// credentialsEnvVar is the environment variable holding the path of the credentials file in the pod's containers
+func (d database) credentialsEnvVar() corev1.EnvVar {
+	name := d.envVar
+	if name == "" {
+		name = defaultCredentialsEnvVar(d.database, d.role)
+	}
+	return corev1.EnvVar{Name: name, Value: path.Join(d.outputPath, d.outputFileName())}
+}
+
+// defaultCredentialsEnvVar is VAULT_CREDS_<DATABASE>_<ROLE>_FILE, with anything that can't be in a name replaced by _
+func defaultCredentialsEnvVar(database, role string) string {
+	name := strings.ToUpper(fmt.Sprintf("VAULT_CREDS_%s_%s_FILE", database, role))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// addEnv gives the containers the credentials file environment variables, leaving any they already set alone
+func addEnv(containers []corev1.Container, initContainers bool, injected map[string]bool, databases []database) []corev1.Container {
+	modifiedContainers := []corev1.Container{}
+
+	for _, container := range containers {
+		container.Env = append([]corev1.EnvVar{}, container.Env...)
+		for _, database := range databases {
+			if !database.mountsInto(container, initContainers, injected) {
+				continue
+			}
+			envVar := database.credentialsEnvVar()
+			if !hasEnvVar(container.Env, envVar.Name) {
+				container.Env = append(container.Env, envVar)
+			}
+		}
+		modifiedContainers = append(modifiedContainers, container)
+	}
+
+	return modifiedContainers
+}
+
+// addEnvPatch adds the environment variables addEnv would add to each container one at a time,
+// path is the JSON pointer to the containers in the pod
+func addEnvPatch(containers []corev1.Container, initContainers bool, injected map[string]bool, path string, databases []database) (patch []patchOperation) {
+	modifiedContainers := addEnv(containers, initContainers, injected, databases)
+
+	for i, container := range containers {
+		newEnv := modifiedContainers[i].Env[len(container.Env):]
+		if len(newEnv) == 0 {
+			continue
+		}
+
+		if len(container.Env) == 0 {
+			patch = append(patch, patchOperation{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/%d/env", path, i),
+				Value: newEnv,
+			})
+			continue
+		}
+		for _, envVar := range newEnv {
+			patch = append(patch, patchOperation{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/%d/env/-", path, i),
+				Value: envVar,
+			})
+		}
+	}
+
+	return patch
+}
+
+func hasEnvVar(env []corev1.EnvVar, name string) bool {
+	for _, envVar := range env {
+		if envVar.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func appendVolumeMountIfMissing(slice []corev1.VolumeMount, v corev1.VolumeMount) []corev1.VolumeMount {
 	for _, ele := range slice {
-		if ele == v {
+		if ele.Name == v.Name && ele.MountPath == v.MountPath {
 			return slice
 		}
 	}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -21,7 +27,7 @@ func TestAddVolumeMount(t *testing.T) {
 		},
 	}
 
-	containers = addVolumeMount(containers, database)
+	containers = addVolumeMount(&v1.Pod{}, containers, false, nil, database)
 	if len(containers) != 2 {
 		t.Errorf("should be two containers, got :%v", len(containers))
 	}
@@ -46,17 +52,63 @@ func TestAddSameVolumeMount(t *testing.T) {
 			outputPath: "/etc/foo",
 		},
 	}
-	containers = addVolumeMount(containers, database)
+	containers = addVolumeMount(&v1.Pod{}, containers, false, nil, database)
 
 	if len(containers[0].VolumeMounts) != 1 {
 		t.Error("got duplicate volume mounts")
 	}
 }
 
+func TestAddVolumeMountJob(t *testing.T) {
+	var tests = []struct {
+		scenario string
+		owner    string
+		native   bool
+		readOnly bool
+	}{
+		{scenario: "deployment", owner: "Deployment", readOnly: true},
+		{scenario: "job with a legacy sidecar", owner: "Job"},
+		{scenario: "workflow with a legacy sidecar", owner: "Workflow"},
+		{scenario: "job with a native sidecar", owner: "Job", native: true, readOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			pod := makePodOwnedByKind(tt.owner)
+			pod.Spec.Containers[0].Name = "job"
+			databases := []database{
+				{database: "foo", role: "bah", outputPath: "/etc/foo", nativeSidecar: tt.native},
+				{database: "baz", role: "foo", outputPath: "/etc/baz", nativeSidecar: tt.native, volumeIsolation: v1alpha1.VolumeIsolationBinding},
+			}
+			original := pod.DeepCopy()
+			patch, err := createPatch(pod, "ns", databases)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			patched := applyPatch(t, original, patch)
+
+			// a --job sidecar only exits once the job has written the completed marker into each binding's volume
+			if n := len(patched.Spec.Containers[0].VolumeMounts); n != 2 {
+				t.Fatalf("expected the job to mount both bindings' volumes, got: %d", n)
+			}
+			for _, mount := range patched.Spec.Containers[0].VolumeMounts {
+				if mount.ReadOnly != tt.readOnly {
+					t.Errorf("expected %s to be mounted read only %t, got: %t", mount.Name, tt.readOnly, mount.ReadOnly)
+				}
+			}
+			for _, c := range vaultContainers(patched.Spec.Containers) {
+				if job := c.Args[len(c.Args)-1] == "--job"; job == tt.readOnly {
+					t.Errorf("expected %s to run with --job only when the mounts are writable, got: %v", c.Name, c.Args)
+				}
+			}
+		})
+	}
+}
+
 func TestAddVolume(t *testing.T) {
 	pod := v1.Pod{}
 
-	patch := addVolume(&pod)
+	patch := addVolumePatch(&pod, v1.Volume{Name: credsVolumeName})
 
 	if patch[0].Path != "/spec/volumes" {
 		t.Errorf("incorrect patch path: %v", patch[0].Path)
@@ -66,7 +118,7 @@ func TestAddVolume(t *testing.T) {
 		Volumes: []v1.Volume{v1.Volume{}},
 	}}
 
-	patch = addVolume(&podWithVolume)
+	patch = addVolumePatch(&podWithVolume, v1.Volume{Name: credsVolumeName})
 	if patch[0].Path != "/spec/volumes/-" {
 		t.Errorf("incorrect patch path: %v", patch[0].Path)
 	}
@@ -97,11 +149,17 @@ func TestAddVaultPatch(t *testing.T) {
 
 	patch := addVault(&pod, "bah", databases)
 
-	if len(patch) != 2 {
-		t.Errorf("patch should have two items, got: %v", len(patch))
+	if len(patch) != 3 {
+		t.Fatalf("patch should have three items, got: %v", len(patch))
+	}
+
+	for _, op := range patch[:2] {
+		if op.Op != "add" || op.Path != "/spec/containers/-" {
+			t.Errorf("patch should be appending sidecars, got: %s %s", op.Op, op.Path)
+		}
 	}
 
-	if patch[1].Op != "add" {
+	if patch[2].Op != "add" || patch[2].Path != "/spec/initContainers" {
 		t.Error("patch should be adding init containers")
 	}
 
@@ -132,12 +190,55 @@ func vaultContainers(containers []v1.Container) []v1.Container {
 }
 
 func containersForPatch(patchOps []patchOperation) []v1.Container {
+	containers := []v1.Container{}
 	for _, patch := range patchOps {
-		if patch.Path == "/spec/containers" {
-			return patch.Value.([]v1.Container)
+		if patch.Path == "/spec/containers/-" {
+			containers = append(containers, patch.Value.(v1.Container))
 		}
 	}
-	return []v1.Container{}
+	return containers
+}
+
+func TestAddVaultNativeSidecar(t *testing.T) {
+	databases := []database{
+		{database: "foo", role: "bah", nativeSidecar: true},
+		{database: "baz", role: "foo"},
+	}
+
+	pod := makePodOwnedByKind("Job")
+	pod.Spec.InitContainers = []v1.Container{{Name: "migrate"}}
+
+	patch := addVault(pod, "ns", databases)
+
+	sidecars := vaultContainers(containersForPatch(patch))
+	if len(sidecars) != 1 || sidecars[0].Name != "vault-creds-baz-foo" {
+		t.Errorf("only the legacy binding should add a regular container, got: %+v", sidecars)
+	}
+
+	expected := []string{"vault-creds-foo-bah-init", "vault-creds-foo-bah", "vault-creds-baz-foo-init", "migrate"}
+	if len(pod.Spec.InitContainers) != len(expected) {
+		t.Fatalf("expected init containers %v, got: %+v", expected, pod.Spec.InitContainers)
+	}
+	for i, name := range expected {
+		if pod.Spec.InitContainers[i].Name != name {
+			t.Errorf("expected init container %d to be %s, got: %s", i, name, pod.Spec.InitContainers[i].Name)
+		}
+	}
+
+	sidecar := pod.Spec.InitContainers[1]
+	if sidecar.RestartPolicy == nil || *sidecar.RestartPolicy != v1.ContainerRestartPolicyAlways {
+		t.Error("native sidecar should have restartPolicy Always")
+	}
+	if checkJobFlagExists(sidecar) {
+		t.Error("native sidecar shouldn't need the job flag")
+	}
+	if pod.Spec.InitContainers[0].RestartPolicy != nil {
+		t.Error("init container should run to completion")
+	}
+
+	if patch, err := createPatch(pod, "ns", databases); err != nil || patch != nil {
+		t.Errorf("pod with native sidecars should not be patched again, got: %s %v", patch, err)
+	}
 }
 
 func checkJobFlagExists(container v1.Container) bool {
@@ -285,3 +386,596 @@ func TestAddLifecyclePreStopHook(t *testing.T) {
 	}
 
 }
+
+func TestCreatePatchIdempotent(t *testing.T) {
+	databases := []database{
+		database{
+			database: "foo_db",
+			role:     "bah",
+		},
+	}
+
+	mutatedPod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{injectedAnnotation: "vault-creds-foo-db-bah"},
+		},
+		Spec: v1.PodSpec{
+			Containers:     []v1.Container{v1.Container{Name: "app"}, v1.Container{Name: "vault-creds-foo-db-bah"}},
+			InitContainers: []v1.Container{v1.Container{Name: "vault-creds-foo-db-bah-init"}},
+			Volumes:        []v1.Volume{v1.Volume{Name: "vault-creds"}},
+		},
+	}
+
+	patch, err := createPatch(&mutatedPod, "bah", databases)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if patch != nil {
+		t.Errorf("already mutated pod should not be patched, got: %s", patch)
+	}
+
+	partialPod := v1.Pod{
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{v1.Container{Name: "app"}, v1.Container{Name: "vault-creds-foo-db-bah"}},
+			Volumes:    []v1.Volume{v1.Volume{Name: "vault-creds"}, v1.Volume{Name: "vault-template"}},
+		},
+	}
+
+	patch, err = createPatch(&partialPod, "bah", databases)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var ops []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		t.Fatalf("could not decode patch: %v", err)
+	}
+
+	for _, op := range ops {
+		switch op.Path {
+		case "/spec/volumes", "/spec/volumes/-":
+			t.Error("should not add a second vault-creds volume")
+		case "/spec/containers", "/spec/containers/-":
+			t.Errorf("should not touch the containers, got: %s %s", op.Op, op.Path)
+		case "/spec/initContainers":
+			var containers []v1.Container
+			json.Unmarshal(op.Value, &containers)
+			if len(containers) != 1 || containers[0].Name != "vault-creds-foo-db-bah-init" {
+				t.Errorf("should add the missing init container, got: %+v", containers)
+			}
+		case "/metadata/annotations":
+			var annotations map[string]string
+			json.Unmarshal(op.Value, &annotations)
+			if annotations[injectedAnnotation] != "vault-creds-foo-db-bah" {
+				t.Errorf("unexpected injected annotation: %v", annotations)
+			}
+		}
+	}
+}
+
+func TestAddVaultAuthRole(t *testing.T) {
+	databases := []database{
+		database{database: "foo", role: "bah", serviceAccount: "worker", authRole: "foo_ns_worker"},
+		database{database: "baz", role: "foo", serviceAccount: "default", authRole: "shared", loginPath: "kubernetes-eu/login"},
+	}
+	loginPath = "kubernetes/login"
+	defer func() { loginPath = "" }()
+
+	containers := vaultContainers(containersForPatch(addVault(makePodOwnedByKind("Deployment"), "ns", databases)))
+	if len(containers) != 2 {
+		t.Fatalf("expected two vault sidecars, got: %d", len(containers))
+	}
+
+	expected := [][]string{
+		{"--auth-role=foo_ns_worker", "--login-path=kubernetes/login"},
+		{"--auth-role=shared", "--login-path=kubernetes-eu/login"},
+	}
+	for i, c := range containers {
+		for _, want := range expected[i] {
+			found := false
+			for _, arg := range c.Args {
+				if arg == want {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected %v in args, got: %v", want, c.Args)
+			}
+		}
+	}
+}
+
+func containerIndex(containers []v1.Container, name string) int {
+	for i, container := range containers {
+		if container.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func countVolumeMounts(container v1.Container, mount v1.VolumeMount) int {
+	count := 0
+	for _, vm := range container.VolumeMounts {
+		if vm.Name == mount.Name && vm.MountPath == mount.MountPath {
+			count++
+		}
+	}
+	return count
+}
+
+// TestCreatePatchFixtures applies the patch to pods as they arrive from the API server,
+// including ones already changed by other webhooks, and checks the resulting pod.
+func TestCreatePatchFixtures(t *testing.T) {
+	orders := database{database: "orders", role: "readonly", outputPath: "/etc/database"}
+	reports := database{database: "reports", role: "readwrite", outputPath: "/etc/reports"}
+
+	nativeOrders := orders
+	nativeOrders.nativeSidecar = true
+	nativeReports := reports
+	nativeReports.nativeSidecar = true
+	inlineReports := reports
+	inlineReports.template = "{{ .Username }}:{{ .Password }}"
+	configMapOrders := orders
+	configMapOrders.templateFrom = &v1alpha1.TemplateSource{
+		ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "orders-templates"}, Key: "readonly"},
+	}
+	isolatedOrders := orders
+	isolatedOrders.outputPath = "/etc/orders"
+	isolatedOrders.volumeIsolation = v1alpha1.VolumeIsolationBinding
+	isolatedReports := reports
+	isolatedReports.volumeIsolation = v1alpha1.VolumeIsolationBinding
+	secretReports := reports
+	secretReports.templateFrom = &v1alpha1.TemplateSource{
+		SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "reports-templates"}, Key: "readwrite"},
+	}
+
+	tests := []struct {
+		fixture   string
+		databases []database
+	}{
+		{fixture: "minimal.json", databases: []database{orders}},
+		{fixture: "minimal.json", databases: []database{orders, reports}},
+		{fixture: "minimal.json", databases: []database{nativeOrders, reports}},
+		{fixture: "init-containers.json", databases: []database{orders}},
+		{fixture: "init-containers.json", databases: []database{nativeOrders, nativeReports}},
+		{fixture: "init-containers.json", databases: []database{orders, inlineReports}},
+		{fixture: "minimal.json", databases: []database{inlineReports}},
+		{fixture: "init-containers.json", databases: []database{configMapOrders, secretReports}},
+		{fixture: "istio.json", databases: []database{secretReports}},
+		{fixture: "multi-container.json", databases: []database{orders, reports}},
+		{fixture: "istio.json", databases: []database{orders}},
+		{fixture: "istio.json", databases: []database{nativeOrders}},
+		{fixture: "partially-injected.json", databases: []database{orders}},
+		{fixture: "partially-injected.json", databases: []database{orders, reports}},
+		{fixture: "partially-injected.json", databases: []database{orders, nativeReports}},
+		{fixture: "partially-injected.json", databases: []database{orders, isolatedReports}},
+		{fixture: "partially-injected.json", databases: []database{isolatedOrders, isolatedReports}},
+	}
+
+	for _, tt := range tests {
+		native := 0
+		for _, db := range tt.databases {
+			if db.nativeSidecar {
+				native++
+			}
+		}
+		t.Run(fmt.Sprintf("%s with %d bindings, %d native", tt.fixture, len(tt.databases), native), func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join("testdata", "pods", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var original, pod v1.Pod
+			if err := json.Unmarshal(raw, &original); err != nil {
+				t.Fatal(err)
+			}
+			json.Unmarshal(raw, &pod)
+
+			patch, err := createPatch(&pod, original.Namespace, tt.databases)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			decoded, err := jsonpatch.DecodePatch(patch)
+			if err != nil {
+				t.Fatalf("invalid patch %s: %v", patch, err)
+			}
+			for _, op := range decoded {
+				if op.Kind() != "add" {
+					t.Errorf("patch should only add to the pod, got: %s %s", op.Kind(), mustPath(op))
+				}
+			}
+
+			patchedRaw, err := decoded.Apply(raw)
+			if err != nil {
+				t.Fatalf("could not apply patch %s: %v", patch, err)
+			}
+			var patched v1.Pod
+			if err := json.Unmarshal(patchedRaw, &patched); err != nil {
+				t.Fatal(err)
+			}
+
+			for key, value := range original.Annotations {
+				if patched.Annotations[key] != value {
+					t.Errorf("annotation %s changed to %q", key, patched.Annotations[key])
+				}
+			}
+
+			for _, db := range tt.databases {
+				volumes := 0
+				for _, volume := range patched.Spec.Volumes {
+					if volume.Name == db.credsVolumeName() {
+						volumes++
+					}
+				}
+				if volumes != 1 {
+					t.Errorf("expected one %s volume, got: %d", db.credsVolumeName(), volumes)
+				}
+			}
+			for _, volume := range original.Spec.Volumes {
+				if !hasVolume(&patched, volume.Name) {
+					t.Errorf("volume %s was removed", volume.Name)
+				}
+			}
+
+			// the pod's own containers keep their position and mounts, and gain the credentials
+			for i, container := range original.Spec.Containers {
+				if patched.Spec.Containers[i].Name != container.Name {
+					t.Errorf("container %d should still be %s, got: %s", i, container.Name, patched.Spec.Containers[i].Name)
+					continue
+				}
+				for _, vm := range container.VolumeMounts {
+					if countVolumeMounts(patched.Spec.Containers[i], vm) != 1 {
+						t.Errorf("container %s lost volume mount %s", container.Name, vm.Name)
+					}
+				}
+				// the webhook's own sidecars only mount what their provider gave them
+				if strings.HasPrefix(container.Name, "vault-creds-") {
+					if !reflect.DeepEqual(patched.Spec.Containers[i].VolumeMounts, container.VolumeMounts) || !reflect.DeepEqual(patched.Spec.Containers[i].Env, container.Env) {
+						t.Errorf("sidecar %s should be left alone, got mounts %v and env %v", container.Name, patched.Spec.Containers[i].VolumeMounts, patched.Spec.Containers[i].Env)
+					}
+					continue
+				}
+				for _, db := range tt.databases {
+					mount := v1.VolumeMount{Name: db.credsVolumeName(), MountPath: db.outputPath}
+					if n := countVolumeMounts(patched.Spec.Containers[i], mount); n != 1 {
+						t.Errorf("container %s should mount %s once, got: %d", container.Name, db.outputPath, n)
+					}
+				}
+			}
+
+			firstInit := len(patched.Spec.InitContainers)
+			for _, container := range original.Spec.InitContainers {
+				i := containerIndex(patched.Spec.InitContainers, container.Name)
+				if i == -1 {
+					t.Errorf("init container %s was removed", container.Name)
+					continue
+				}
+				if i < firstInit {
+					firstInit = i
+				}
+				for _, db := range tt.databases {
+					mount := v1.VolumeMount{Name: db.credsVolumeName(), MountPath: db.outputPath}
+					if n := countVolumeMounts(patched.Spec.InitContainers[i], mount); n != 1 {
+						t.Errorf("init container %s should mount %s once, got: %d", container.Name, db.outputPath, n)
+					}
+				}
+			}
+
+			if n := len(vaultContainers(patched.Spec.Containers)); n != len(tt.databases)-native {
+				t.Errorf("expected %d sidecars, got: %d", len(tt.databases)-native, n)
+			}
+			for _, db := range tt.databases {
+				i := containerIndex(patched.Spec.InitContainers, db.containerName()+"-init")
+				if i == -1 {
+					t.Errorf("missing init container %s-init", db.containerName())
+				} else if i > firstInit {
+					t.Errorf("%s-init should run before the pod's init containers", db.containerName())
+				}
+
+				if !db.nativeSidecar {
+					if containerIndex(patched.Spec.Containers, db.containerName()) == -1 {
+						t.Errorf("missing sidecar %s", db.containerName())
+					}
+				} else if sidecar := containerIndex(patched.Spec.InitContainers, db.containerName()); sidecar != i+1 {
+					t.Errorf("native sidecar %s should run straight after its init container", db.containerName())
+				} else if policy := patched.Spec.InitContainers[sidecar].RestartPolicy; policy == nil || *policy != v1.ContainerRestartPolicyAlways {
+					t.Errorf("native sidecar %s should have restartPolicy Always", db.containerName())
+				}
+				if !strings.Contains(patched.Annotations[injectedAnnotation], db.containerName()) {
+					t.Errorf("%s missing from the injected annotation: %q", db.containerName(), patched.Annotations[injectedAnnotation])
+				}
+			}
+
+			patch, err = createPatch(&patched, original.Namespace, tt.databases)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if patch != nil {
+				t.Errorf("patched pod should not be patched again, got: %s", patch)
+			}
+		})
+	}
+}
+
+func mustPath(op jsonpatch.Operation) string {
+	path, _ := op.Path()
+	return path
+}
+
+func TestAddVaultLeaseArgs(t *testing.T) {
+	databases := []database{
+		{database: "foo", role: "bah", renewInterval: 5 * time.Minute, leaseDuration: 15 * time.Minute},
+	}
+	pod := makePodOwnedByKind("Job")
+
+	containers := vaultContainers(containersForPatch(addVault(pod, "ns", databases)))
+	if len(containers) != 1 {
+		t.Fatalf("expected one vault sidecar, got: %d", len(containers))
+	}
+	for _, expected := range []string{"--renew-interval=5m0s", "--lease-duration=15m0s"} {
+		found := false
+		for _, arg := range containers[0].Args {
+			if arg == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %s in args, got: %v", expected, containers[0].Args)
+		}
+	}
+}
+
+func TestCapLeaseDuration(t *testing.T) {
+	var tests = []struct {
+		lease    time.Duration
+		deadline time.Duration
+		expected time.Duration
+	}{
+		{lease: 12 * time.Hour, deadline: 0, expected: 12 * time.Hour},
+		{lease: 12 * time.Hour, deadline: 30 * time.Minute, expected: 30 * time.Minute},
+		{lease: 15 * time.Minute, deadline: time.Hour, expected: 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if actual := capLeaseDuration(tt.lease, tt.deadline); actual != tt.expected {
+			t.Errorf("capLeaseDuration(%s, %s) expected %s, got: %s", tt.lease, tt.deadline, tt.expected, actual)
+		}
+	}
+}
+
+func TestCreatePatchInlineTemplate(t *testing.T) {
+	databases := []database{
+		{database: "foo_db", role: "bah", outputPath: "/etc/database", template: "{{ .Username }}"},
+		{database: "baz", role: "foo", outputPath: "/etc/database"},
+	}
+	raw := []byte(`{"metadata":{"name":"app"},"spec":{"containers":[{"name":"app"}]}}`)
+	var pod v1.Pod
+	json.Unmarshal(raw, &pod)
+
+	patch, err := createPatch(&pod, "ns", databases)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decoded, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		t.Fatalf("invalid patch %s: %v", patch, err)
+	}
+	patchedRaw, err := decoded.Apply(raw)
+	if err != nil {
+		t.Fatalf("could not apply patch %s: %v", patch, err)
+	}
+	var patched v1.Pod
+	json.Unmarshal(patchedRaw, &patched)
+
+	if patched.Annotations["vault-webhook.uswitch.com/template-foo_db-bah"] != "{{ .Username }}" {
+		t.Errorf("template should be carried in an annotation, got: %v", patched.Annotations)
+	}
+	if patched.Annotations[injectedAnnotation] != "vault-creds-baz-foo,vault-creds-foo-db-bah" {
+		t.Errorf("unexpected injected annotation: %v", patched.Annotations)
+	}
+
+	var volume *v1.Volume
+	for i := range patched.Spec.Volumes {
+		if patched.Spec.Volumes[i].Name == "vault-template-foo-db-bah" {
+			volume = &patched.Spec.Volumes[i]
+		}
+	}
+	if volume == nil || volume.Projected == nil {
+		t.Fatalf("expected a projected template volume, got: %+v", patched.Spec.Volumes)
+	}
+	item := volume.Projected.Sources[0].DownwardAPI.Items[0]
+	if item.Path != "foo_db-bah" || item.FieldRef.FieldPath != "metadata.annotations['vault-webhook.uswitch.com/template-foo_db-bah']" {
+		t.Errorf("template volume should project the annotation to the template key, got: %+v", item)
+	}
+
+	templateMount := func(c v1.Container) string {
+		for _, vm := range c.VolumeMounts {
+			if vm.MountPath == "/creds/template" {
+				return vm.Name
+			}
+		}
+		return ""
+	}
+	for _, c := range append(patched.Spec.Containers, patched.Spec.InitContainers...) {
+		switch c.Name {
+		case "vault-creds-foo-db-bah", "vault-creds-foo-db-bah-init":
+			if templateMount(c) != "vault-template-foo-db-bah" {
+				t.Errorf("%s should read the inline template, got: %s", c.Name, templateMount(c))
+			}
+		case "vault-creds-baz-foo", "vault-creds-baz-foo-init":
+			if templateMount(c) != "vault-template" {
+				t.Errorf("%s should read the vault-template volume, got: %s", c.Name, templateMount(c))
+			}
+		}
+	}
+
+	if patch, err := createPatch(&patched, "ns", databases); err != nil || patch != nil {
+		t.Errorf("patched pod should not be patched again, got: %s %v", patch, err)
+	}
+}
+
+func TestTemplateVolume(t *testing.T) {
+	optional := true
+	d := database{database: "foo_db", role: "bah", templateFrom: &v1alpha1.TemplateSource{
+		ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "templates"}, Key: "foo.tmpl", Optional: &optional},
+	}}
+
+	volume := templateVolume(d)
+	if volume.Name != "vault-template-foo-db-bah" || d.sidecarTemplateVolume() != volume.Name {
+		t.Errorf("unexpected template volume name: %s", volume.Name)
+	}
+	configMap := volume.Projected.Sources[0].ConfigMap
+	if configMap == nil || configMap.Name != "templates" || configMap.Optional == nil || !*configMap.Optional {
+		t.Fatalf("expected the templates config map to be projected, got: %+v", volume.Projected.Sources[0])
+	}
+	if len(configMap.Items) != 1 || configMap.Items[0].Key != "foo.tmpl" || configMap.Items[0].Path != "foo_db-bah" {
+		t.Errorf("expected foo.tmpl to be projected as the template key, got: %+v", configMap.Items)
+	}
+
+	d.templateFrom = &v1alpha1.TemplateSource{
+		SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "secret-templates"}, Key: "foo.tmpl"},
+	}
+	secret := templateVolume(d).Projected.Sources[0].Secret
+	if secret == nil || secret.Name != "secret-templates" || secret.Items[0].Path != "foo_db-bah" {
+		t.Errorf("expected the secret to be projected, got: %+v", templateVolume(d).Projected.Sources[0])
+	}
+
+	if (database{database: "foo_db", role: "bah"}).sidecarTemplateVolume() != "vault-template" {
+		t.Error("bindings without their own template should use the vault-template volume")
+	}
+}
+
+func TestCreatePatchCredentialsEnv(t *testing.T) {
+	databases := []database{
+		{database: "my_db", role: "read-only", outputPath: "/etc/database"},
+		{database: "other", role: "admin", outputPath: "/etc/other", outputFile: "creds.json", envVar: "OTHER_CREDENTIALS"},
+	}
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Name: "migrate"}},
+			Containers: []v1.Container{
+				{Name: "app", Env: []v1.EnvVar{{Name: "OTHER_CREDENTIALS", Value: "/mine"}}},
+				{Name: "worker"},
+			},
+		},
+	}
+	original := pod.DeepCopy()
+
+	patch, err := createPatch(pod, "ns", databases)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	patched := applyPatch(t, original, patch)
+
+	expected := map[string][]v1.EnvVar{
+		"migrate": {{Name: "VAULT_CREDS_MY_DB_READ_ONLY_FILE", Value: "/etc/database/my_db-read-only"}, {Name: "OTHER_CREDENTIALS", Value: "/etc/other/creds.json"}},
+		"app":     {{Name: "OTHER_CREDENTIALS", Value: "/mine"}, {Name: "VAULT_CREDS_MY_DB_READ_ONLY_FILE", Value: "/etc/database/my_db-read-only"}},
+		"worker":  {{Name: "VAULT_CREDS_MY_DB_READ_ONLY_FILE", Value: "/etc/database/my_db-read-only"}, {Name: "OTHER_CREDENTIALS", Value: "/etc/other/creds.json"}},
+	}
+	for _, c := range append(patched.Spec.InitContainers, patched.Spec.Containers...) {
+		want, ok := expected[c.Name]
+		if !ok {
+			continue
+		}
+		if !reflect.DeepEqual(c.Env, want) {
+			t.Errorf("expected env %v for %s, got: %v", want, c.Name, c.Env)
+		}
+	}
+}
+
+func applyPatch(t *testing.T, pod *v1.Pod, patch []byte) v1.Pod {
+	t.Helper()
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("could not marshal pod: %v", err)
+	}
+	decoded, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		t.Fatalf("invalid patch %s: %v", patch, err)
+	}
+	patchedRaw, err := decoded.Apply(raw)
+	if err != nil {
+		t.Fatalf("could not apply patch %s: %v", patch, err)
+	}
+	var patched v1.Pod
+	json.Unmarshal(patchedRaw, &patched)
+	return patched
+}
+
+func TestCreatePatchTargetContainers(t *testing.T) {
+	always := v1.ContainerRestartPolicyAlways
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{
+				{Name: "migrate"},
+				{Name: "istio-proxy", RestartPolicy: &always},
+			},
+			Containers: []v1.Container{
+				{Name: "app"},
+				{Name: "log-shipper"},
+			},
+		},
+	}
+
+	var tests = []struct {
+		scenario string
+		database database
+		expected []string
+	}{
+		{
+			scenario: "every container by default",
+			database: database{database: "foo", role: "bah", outputPath: "/etc/database"},
+			expected: []string{"migrate", "istio-proxy", "app", "log-shipper"},
+		},
+		{
+			scenario: "only the listed containers and init containers",
+			database: database{database: "foo", role: "bah", outputPath: "/etc/database", containers: []string{"app"}},
+			expected: []string{"migrate", "app"},
+		},
+		{
+			scenario: "no init containers",
+			database: database{database: "foo", role: "bah", outputPath: "/etc/database", skipInitContainers: true},
+			expected: []string{"istio-proxy", "app", "log-shipper"},
+		},
+		{
+			scenario: "only the listed containers",
+			database: database{database: "foo", role: "bah", outputPath: "/etc/database", containers: []string{"app"}, skipInitContainers: true},
+			expected: []string{"app"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			original := pod.DeepCopy()
+			patch, err := createPatch(pod.DeepCopy(), "ns", []database{tt.database})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			patched := applyPatch(t, original, patch)
+
+			mounted := []string{}
+			for _, c := range append(patched.Spec.InitContainers, patched.Spec.Containers...) {
+				if strings.HasPrefix(c.Name, "vault-creds-") {
+					continue
+				}
+				mount := countVolumeMounts(c, v1.VolumeMount{Name: credsVolumeName, MountPath: "/etc/database"})
+				env := hasEnvVar(c.Env, "VAULT_CREDS_FOO_BAH_FILE")
+				if (mount != 0) != env {
+					t.Errorf("expected %s to get both the mount and the env var, got mounts: %v env: %v", c.Name, c.VolumeMounts, c.Env)
+				}
+				if env {
+					mounted = append(mounted, c.Name)
+				}
+			}
+			if !reflect.DeepEqual(mounted, tt.expected) {
+				t.Errorf("expected credentials in %v, got: %v", tt.expected, mounted)
+			}
+		})
+	}
+}
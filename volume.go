@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	// defaultVolumeIsolation is used by bindings that don't set one, from --volume-isolation
+	defaultVolumeIsolation = v1alpha1.VolumeIsolationShared
+	// defaultVolumeMedium is used by bindings that don't set one, from --volume-medium
+	defaultVolumeMedium = v1alpha1.VolumeMediumMemory
+	// defaultVolumeSizeLimit is used by bindings that don't set one, from --volume-size-limit
+	defaultVolumeSizeLimit *resource.Quantity
+)
+
+func parseVolumeSizeLimit(limit string) (*resource.Quantity, error) {
+	if limit == "" {
+		return nil, nil
+	}
+	quantity, err := resource.ParseQuantity(limit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quantity %q: %s", limit, err)
+	}
+	if quantity.Sign() <= 0 {
+		return nil, fmt.Errorf("%s must be positive", limit)
+	}
+	return &quantity, nil
+}
+
+// isolated is whether the database's credentials are written to a volume of their own
+func (d database) isolated() bool {
+	isolation := d.volumeIsolation
+	if isolation == "" {
+		isolation = defaultVolumeIsolation
+	}
+	return isolation == v1alpha1.VolumeIsolationBinding
+}
+
+// defaultOutputPathFor is where a database without an outputPath is mounted, defaultOutputPath unless
+// it's isolated, then a directory named after it so isolated databases don't end up at the same path
+func (d database) defaultOutputPathFor() string {
+	if d.isolated() {
+		return path.Join(defaultOutputPath, templateKey(d.database, d.role))
+	}
+	return defaultOutputPath
+}
+
+// credsVolumeName is the volume the database's credentials are written to, vault-creds unless
+// they're isolated, then the volume is named after the sidecar
+func (d database) credsVolumeName() string {
+	if d.isolated() {
+		return d.containerName()
+	}
+	return credsVolumeName
+}
+
+// inMemory is whether the database's credentials volume is a tmpfs
+func (d database) inMemory() bool {
+	medium := d.volumeMedium
+	if medium == "" {
+		medium = defaultVolumeMedium
+	}
+	return medium == v1alpha1.VolumeMediumMemory
+}
+
+func (d database) volumeSizeLimit() *resource.Quantity {
+	if d.sizeLimit != nil {
+		return d.sizeLimit
+	}
+	return defaultVolumeSizeLimit
+}
+
+// credsVolumes are the emptyDir volumes the databases' credentials are written to. The databases
+// sharing vault-creds get it in memory if any of them asks for it, with the largest size limit any of them sets.
+func credsVolumes(databases []database) []corev1.Volume {
+	volumes := []corev1.Volume{}
+	index := map[string]int{}
+	for _, d := range databases {
+		name := d.credsVolumeName()
+		i, ok := index[name]
+		if !ok {
+			i = len(volumes)
+			index[name] = i
+			volumes = append(volumes, corev1.Volume{
+				Name: name,
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{},
+				},
+			})
+		}
+
+		emptyDir := volumes[i].EmptyDir
+		if d.inMemory() {
+			emptyDir.Medium = corev1.StorageMediumMemory
+		}
+		if limit := d.volumeSizeLimit(); limit != nil && (emptyDir.SizeLimit == nil || limit.Cmp(*emptyDir.SizeLimit) > 0) {
+			sizeLimit := limit.DeepCopy()
+			emptyDir.SizeLimit = &sizeLimit
+		}
+	}
+	return volumes
+}
+
+// conflictingMounts describes the databases whose credentials would be mounted from different
+// volumes at the same outputPath of a container, which Kubernetes doesn't allow
+func conflictingMounts(pod *corev1.Pod, databases []database) []string {
+	var conflicts []string
+	injected := webhookContainers(pod, databases)
+	for i, a := range databases {
+		for _, b := range databases[i+1:] {
+			if a.outputPath == b.outputPath && a.credsVolumeName() != b.credsVolumeName() && shareContainer(pod, injected, a, b) {
+				conflicts = append(conflicts, fmt.Sprintf("%s/%s and %s/%s are in different volumes but both mounted at %s", a.database, a.role, b.database, b.role, a.outputPath))
+			}
+		}
+	}
+	return conflicts
+}
+
+// shareContainer is whether any of the pod's containers get both databases' credentials
+func shareContainer(pod *corev1.Pod, injected map[string]bool, a, b database) bool {
+	for _, c := range pod.Spec.Containers {
+		if a.mountsInto(c, false, injected) && b.mountsInto(c, false, injected) {
+			return true
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		if a.mountsInto(c, true, injected) && b.mountsInto(c, true, injected) {
+			return true
+		}
+	}
+	return false
+}
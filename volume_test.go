@@ -0,0 +1,221 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestCreatePatchIsolatedVolumes(t *testing.T) {
+	databases := []database{
+		{database: "reporting", role: "readonly", outputPath: "/etc/reporting", volumeIsolation: v1alpha1.VolumeIsolationBinding, containers: []string{"app"}},
+		{database: "payments", role: "admin", outputPath: "/etc/payments", volumeIsolation: v1alpha1.VolumeIsolationBinding, containers: []string{"worker"}},
+		{database: "users", role: "readonly", outputPath: "/etc/users"},
+	}
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app"}, {Name: "worker"}}}}
+	original := pod.DeepCopy()
+
+	patch, err := createPatch(pod, "ns", databases)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	patched := applyPatch(t, original, patch)
+
+	volumes := []string{}
+	for _, volume := range patched.Spec.Volumes {
+		if volume.EmptyDir == nil {
+			t.Errorf("expected %s to be an emptyDir, got: %+v", volume.Name, volume.VolumeSource)
+		}
+		volumes = append(volumes, volume.Name)
+	}
+	if expected := []string{"vault-creds-reporting-readonly", "vault-creds-payments-admin", "vault-creds", "vault-template"}; !reflect.DeepEqual(volumes, expected) {
+		t.Errorf("expected volumes %v, got: %v", expected, volumes)
+	}
+
+	expected := map[string][]string{
+		"app":                                 {"vault-creds-reporting-readonly:/etc/reporting", "vault-creds:/etc/users"},
+		"worker":                              {"vault-creds-payments-admin:/etc/payments", "vault-creds:/etc/users"},
+		"vault-creds-reporting-readonly":      {"vault-creds-reporting-readonly:/creds/output", "vault-template:/creds/template"},
+		"vault-creds-reporting-readonly-init": {"vault-creds-reporting-readonly:/creds/output", "vault-template:/creds/template"},
+		"vault-creds-payments-admin":          {"vault-creds-payments-admin:/creds/output", "vault-template:/creds/template"},
+		"vault-creds-users-readonly":          {"vault-creds:/creds/output", "vault-template:/creds/template"},
+	}
+	for _, c := range append(patched.Spec.InitContainers, patched.Spec.Containers...) {
+		want, ok := expected[c.Name]
+		if !ok {
+			continue
+		}
+		mounts := []string{}
+		for _, mount := range c.VolumeMounts {
+			mounts = append(mounts, mount.Name+":"+mount.MountPath)
+			if app := !strings.HasPrefix(c.Name, "vault-creds-"); app != mount.ReadOnly && mount.Name != defaultTemplateVolumeName {
+				t.Errorf("expected only the sidecar to be able to write to %s, got read only %t in %s", mount.Name, mount.ReadOnly, c.Name)
+			}
+		}
+		sort.Strings(mounts)
+		if !reflect.DeepEqual(mounts, want) {
+			t.Errorf("expected %s to mount %v, got: %v", c.Name, want, mounts)
+		}
+	}
+}
+
+func TestConflictingMounts(t *testing.T) {
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app"}, {Name: "worker"}}}}
+
+	var tests = []struct {
+		scenario  string
+		databases []database
+		conflicts int
+	}{
+		{
+			scenario: "shared volume at the same path",
+			databases: []database{
+				{database: "foo", role: "bah", outputPath: "/etc/database"},
+				{database: "baz", role: "foo", outputPath: "/etc/database"},
+			},
+		},
+		{
+			scenario: "own volume at the same path",
+			databases: []database{
+				{database: "foo", role: "bah", outputPath: "/etc/database", volumeIsolation: v1alpha1.VolumeIsolationBinding},
+				{database: "baz", role: "foo", outputPath: "/etc/database"},
+			},
+			conflicts: 1,
+		},
+		{
+			scenario: "own volumes at different paths",
+			databases: []database{
+				{database: "foo", role: "bah", outputPath: "/etc/foo", volumeIsolation: v1alpha1.VolumeIsolationBinding},
+				{database: "baz", role: "foo", outputPath: "/etc/baz", volumeIsolation: v1alpha1.VolumeIsolationBinding},
+			},
+		},
+		{
+			scenario: "own volumes at the same path in different containers",
+			databases: []database{
+				{database: "foo", role: "bah", outputPath: "/etc/database", volumeIsolation: v1alpha1.VolumeIsolationBinding, containers: []string{"app"}},
+				{database: "baz", role: "foo", outputPath: "/etc/database", volumeIsolation: v1alpha1.VolumeIsolationBinding, containers: []string{"worker"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			if conflicts := conflictingMounts(pod, tt.databases); len(conflicts) != tt.conflicts {
+				t.Errorf("expected %d conflicts, got: %v", tt.conflicts, conflicts)
+			}
+		})
+	}
+}
+
+func TestVolumeIsolationDefault(t *testing.T) {
+	defaultVolumeIsolation = v1alpha1.VolumeIsolationBinding
+	defer func() { defaultVolumeIsolation = v1alpha1.VolumeIsolationShared }()
+
+	if name := (database{database: "foo_db", role: "bah"}).credsVolumeName(); name != "vault-creds-foo-db-bah" {
+		t.Errorf("expected a volume of its own with --volume-isolation=binding, got: %s", name)
+	}
+	if name := (database{database: "foo_db", role: "bah", volumeIsolation: v1alpha1.VolumeIsolationShared}).credsVolumeName(); name != credsVolumeName {
+		t.Errorf("expected the binding to override --volume-isolation, got: %s", name)
+	}
+}
+
+func TestCredsVolumes(t *testing.T) {
+	defaultVolumeSizeLimit = resource.NewQuantity(1<<20, resource.BinarySI)
+	defer func() { defaultVolumeSizeLimit = nil }()
+	small, large := resource.MustParse("512Ki"), resource.MustParse("4Mi")
+
+	var tests = []struct {
+		scenario  string
+		databases []database
+		expected  []v1.EmptyDirVolumeSource
+	}{
+		{
+			scenario:  "in memory by default",
+			databases: []database{{database: "foo", role: "bah"}},
+			expected:  []v1.EmptyDirVolumeSource{{Medium: v1.StorageMediumMemory, SizeLimit: resource.NewQuantity(1<<20, resource.BinarySI)}},
+		},
+		{
+			scenario:  "on disk with its own size limit",
+			databases: []database{{database: "foo", role: "bah", volumeMedium: v1alpha1.VolumeMediumDisk, sizeLimit: &small}},
+			expected:  []v1.EmptyDirVolumeSource{{SizeLimit: &small}},
+		},
+		{
+			scenario: "shared in memory if any binding asks for it with the largest limit",
+			databases: []database{
+				{database: "foo", role: "bah", volumeMedium: v1alpha1.VolumeMediumDisk, sizeLimit: &small},
+				{database: "baz", role: "foo", sizeLimit: &large},
+			},
+			expected: []v1.EmptyDirVolumeSource{{Medium: v1.StorageMediumMemory, SizeLimit: &large}},
+		},
+		{
+			scenario: "isolated volumes with their own settings",
+			databases: []database{
+				{database: "foo", role: "bah", volumeMedium: v1alpha1.VolumeMediumDisk, sizeLimit: &small, volumeIsolation: v1alpha1.VolumeIsolationBinding},
+				{database: "baz", role: "foo", sizeLimit: &large},
+			},
+			expected: []v1.EmptyDirVolumeSource{{SizeLimit: &small}, {Medium: v1.StorageMediumMemory, SizeLimit: &large}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			volumes := credsVolumes(tt.databases)
+			if len(volumes) != len(tt.expected) {
+				t.Fatalf("expected %d volumes, got: %+v", len(tt.expected), volumes)
+			}
+			for i, volume := range volumes {
+				expected := tt.expected[i]
+				if volume.EmptyDir.Medium != expected.Medium || volume.EmptyDir.SizeLimit.Cmp(*expected.SizeLimit) != 0 {
+					t.Errorf("expected %s to be %+v, got: %+v", volume.Name, expected, *volume.EmptyDir)
+				}
+			}
+		})
+	}
+}
+
+func TestParseVolumeSizeLimit(t *testing.T) {
+	if limit, err := parseVolumeSizeLimit(""); limit != nil || err != nil {
+		t.Errorf("expected no limit, got: %v %v", limit, err)
+	}
+	if limit, err := parseVolumeSizeLimit("1Mi"); err != nil || limit.String() != "1Mi" {
+		t.Errorf("expected a 1Mi limit, got: %v %v", limit, err)
+	}
+	for _, invalid := range []string{"lots", "0", "-1Mi"} {
+		if _, err := parseVolumeSizeLimit(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestIsolatedDefaultOutputPath(t *testing.T) {
+	defaultVolumeIsolation = v1alpha1.VolumeIsolationBinding
+	defer func() { defaultVolumeIsolation = v1alpha1.VolumeIsolationShared }()
+
+	bindings := []v1alpha1.DatabaseCredentialBinding{
+		{Spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "readonly"}},
+		{Spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "otherdb", Role: "admin"}},
+		{Spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "shared", Role: "readonly", Volume: v1alpha1.CredentialsVolume{Isolation: v1alpha1.VolumeIsolationShared}}},
+		{Spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "own", Role: "readonly", OutputPath: "/config"}},
+	}
+	pod := &v1.Pod{Spec: v1.PodSpec{ServiceAccountName: "foo", Containers: []v1.Container{{Name: "app"}}}}
+
+	databases := matchBindings(bindings, pod)
+	paths := []string{}
+	for _, d := range databases {
+		paths = append(paths, d.outputPath)
+	}
+	if expected := []string{"/etc/database/mydb-readonly", "/etc/database/otherdb-admin", "/etc/database", "/config"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected output paths %v, got: %v", expected, paths)
+	}
+	if conflicts := conflictingMounts(pod, databases[:2]); len(conflicts) != 0 {
+		t.Errorf("expected isolated bindings on the default path not to conflict, got: %v", conflicts)
+	}
+	if env := databases[0].credentialsEnvVar(); env.Value != "/etc/database/mydb-readonly/mydb-readonly" {
+		t.Errorf("expected the env var to point into the binding's own directory, got: %s", env.Value)
+	}
+}
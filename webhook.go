@@ -6,16 +6,26 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
 	"k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 
 	"k8s.io/client-go/kubernetes"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 var (
@@ -24,11 +34,41 @@ var (
 	deserializer  = codecs.UniversalDeserializer()
 )
 
+// Requests that don't declare an apiVersion are treated as v1beta1, which is
+// what we accepted before v1 support was added.
+var defaultAdmissionReviewKind = v1beta1.SchemeGroupVersion.WithKind("AdmissionReview")
+
+func init() {
+	utilruntime.Must(admissionv1.AddToScheme(runtimeScheme))
+	utilruntime.Must(v1beta1.AddToScheme(runtimeScheme))
+}
+
+const (
+	// injectAnnotation set to "false" on a pod skips injection entirely
+	injectAnnotation = "vault-webhook.uswitch.com/inject"
+	// bindingsAnnotation restricts injection to a comma separated list of binding names
+	bindingsAnnotation = "vault-webhook.uswitch.com/bindings"
+
+	defaultOutputPath = "/etc/database"
+)
+
 type webHookServer struct {
-	server   *http.Server
-	client   *kubernetes.Clientset
-	bindings *bindingAggregator
-	ctx      context.Context
+	server          *http.Server
+	client          kubernetes.Interface
+	bindings        *bindingAggregator
+	clusterBindings *clusterBindingAggregator
+	connections     *connectionAggregator
+	namespaces      corelisters.NamespaceLister
+	limitRanges     corelisters.LimitRangeLister
+	jobs            batchlisters.JobLister
+	configMaps      corelisters.ConfigMapLister
+	recorder        record.EventRecorder
+	nativeSidecars  bool
+	// default requests and limits for the vault-creds containers
+	sidecarResources corev1.ResourceRequirements
+	// whether pods missing their vault-template are denied or allowed with a warning
+	missingTemplatePolicy string
+	ctx                   context.Context
 }
 
 type patchOperation struct {
@@ -42,10 +82,47 @@ type database struct {
 	role           string
 	outputPath     string
 	outputFile     string
+	serviceAccount string
 	vaultContainer v1alpha1.Container
+	nativeSidecar  bool
+	provider       string
+	resources      corev1.ResourceRequirements
+	renewInterval  time.Duration
+	leaseDuration  time.Duration
+	template       string
+	templateFrom   *v1alpha1.TemplateSource
+	// authRole is the binding's authRole until mutate resolves it from the auth role template
+	authRole  string
+	loginPath string
+	// vaultConnectionName is the binding's VaultConnection, mutate looks it up into connection
+	vaultConnectionName string
+	connection          *vaultConnection
+	vaultNamespace      string
+	envVar              string
+	// containers are the names of the containers that get the credentials, all of them when empty
+	containers         []string
+	skipInitContainers bool
+	volumeIsolation    string
+	volumeMedium       string
+	sizeLimit          *resource.Quantity
+	binding            *corev1.ObjectReference
+	// restricted is whether the sidecar gets the restricted security context, mutate sets it from
+	// --restricted-security-context and the namespace's Pod Security label
+	restricted bool
 }
 
+type admitFunc func(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
+
 func (srv webHookServer) serve(w http.ResponseWriter, r *http.Request) {
+	srv.handle(w, r, srv.mutate)
+}
+
+func (srv webHookServer) serveValidate(w http.ResponseWriter, r *http.Request) {
+	srv.handle(w, r, srv.validate)
+}
+
+// handle decodes the AdmissionReview, passes the request to admit and writes back its response
+func (srv webHookServer) handle(w http.ResponseWriter, r *http.Request, admit admitFunc) {
 	var body []byte
 	if r.Body != nil {
 		if data, err := ioutil.ReadAll(r.Body); err == nil {
@@ -66,32 +143,51 @@ func (srv webHookServer) serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var admissionResponse *v1beta1.AdmissionResponse
-	ar := v1beta1.AdmissionReview{}
-	if _, _, err := deserializer.Decode(body, nil, &ar); err != nil {
+	// answer in the same version of AdmissionReview that we were sent
+	obj, gvk, err := deserializer.Decode(body, &defaultAdmissionReviewKind, nil)
+	if err != nil {
 		log.Errorf("Can't decode body: %v", err)
-		admissionResponse = &v1beta1.AdmissionResponse{
-			Result: &metav1.Status{
-				Message: err.Error(),
-			},
-		}
-	} else {
-		admissionResponse = srv.mutate(&ar)
+		http.Error(w, fmt.Sprintf("could not decode body: %v", err), http.StatusBadRequest)
+		return
 	}
 
-	admissionReview := v1beta1.AdmissionReview{}
-	if admissionResponse != nil {
-		admissionReview.Response = admissionResponse
-		if ar.Request != nil {
-			admissionReview.Response.UID = ar.Request.UID
+	var admissionReview runtime.Object
+	switch ar := obj.(type) {
+	case *admissionv1.AdmissionReview:
+		if ar.Request == nil {
+			http.Error(w, "admission review has no request", http.StatusBadRequest)
+			return
+		}
+		admissionResponse := admit(ar.Request)
+		admissionResponse.UID = ar.Request.UID
+		admissionReview = &admissionv1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind},
+			Response: admissionResponse,
+		}
+	case *v1beta1.AdmissionReview:
+		if ar.Request == nil {
+			http.Error(w, "admission review has no request", http.StatusBadRequest)
+			return
 		}
+		admissionResponse := toV1beta1AdmissionResponse(admit(toV1AdmissionRequest(ar.Request)))
+		admissionResponse.UID = ar.Request.UID
+		admissionReview = &v1beta1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind},
+			Response: admissionResponse,
+		}
+	default:
+		log.Errorf("Unsupported kind %v", gvk)
+		http.Error(w, fmt.Sprintf("unsupported kind %v, expect AdmissionReview", gvk), http.StatusBadRequest)
+		return
 	}
 
 	resp, err := json.Marshal(admissionReview)
 	if err != nil {
 		log.Errorf("Can't encode response: %v", err)
 		http.Error(w, fmt.Sprintf("could not encode response: %v", err), http.StatusInternalServerError)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	log.Infof("Ready to write reponse ...")
 	if _, err := w.Write(resp); err != nil {
 		log.Errorf("Can't write response: %v", err)
@@ -101,13 +197,12 @@ func (srv webHookServer) serve(w http.ResponseWriter, r *http.Request) {
 }
 
 // This handles the admission review sent by k8s and mutates the pod
-func (srv webHookServer) mutate(ar *v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
-	req := ar.Request
+func (srv webHookServer) mutate(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
 
 	var pod corev1.Pod
 	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
 		log.Errorf("Could not unmarshal raw object: %v", err)
-		return &v1beta1.AdmissionResponse{
+		return &admissionv1.AdmissionResponse{
 			Result: &metav1.Status{
 				Message: err.Error(),
 			},
@@ -123,11 +218,22 @@ func (srv webHookServer) mutate(ar *v1beta1.AdmissionReview) *v1beta1.AdmissionR
 	log.Infof("AdmissionReview for Kind=%v, Namespace=%v Name=%v UID=%v patchOperation=%v UserInfo=%v",
 		ownerKind, req.Namespace, ownerName, req.UID, req.Operation, req.UserInfo)
 
+	if inject, ok := pod.ObjectMeta.Annotations[injectAnnotation]; ok {
+		if enabled, err := strconv.ParseBool(inject); err == nil && !enabled {
+			log.Infof("Skipping mutation for %s/%s, disabled by %s annotation", req.Namespace, ownerName, injectAnnotation)
+			srv.recordEvent(req, []*corev1.ObjectReference{ownerReference(&pod, req.Namespace)}, corev1.EventTypeNormal, reasonInjectionSkipped,
+				"Skipped injecting vault-creds into pod %s, disabled by %s annotation", podName(&pod), injectAnnotation)
+			return &admissionv1.AdmissionResponse{
+				Allowed: true,
+			}
+		}
+	}
+
 	// A list of ALL the bindings.
 	binds, err := srv.bindings.List()
 	log.Infof("[mutate] List of all bindings: %+v", binds)
 	if err != nil {
-		return &v1beta1.AdmissionResponse{
+		return &admissionv1.AdmissionResponse{
 			Result: &metav1.Status{
 				Message: err.Error(),
 			},
@@ -136,42 +242,310 @@ func (srv webHookServer) mutate(ar *v1beta1.AdmissionReview) *v1beta1.AdmissionR
 
 	// Filter out the bindings that are not in the target namespace
 	filteredBindings := filterBindings(binds, req.Namespace)
-	if len(filteredBindings) == 0 {
+
+	// Cluster bindings whose NamespaceSelector matches the target namespace
+	clusterBindings, err := srv.namespaceClusterBindings(req.Namespace)
+	if err != nil {
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+
+	if len(filteredBindings) == 0 && len(clusterBindings) == 0 {
 		log.Infof("Skipping mutation for %s/%s, no database credential bindings in namespace", req.Namespace, ownerName)
-		return &v1beta1.AdmissionResponse{
+		return &admissionv1.AdmissionResponse{
 			Allowed: true,
 		}
 	}
 
-	// Identify bindings with ServiceAccount field matching the pod's ServiceAccountName
-	databases := matchBindings(filteredBindings, pod.Spec.ServiceAccountName)
+	// Restrict to the bindings the pod has asked for by name
+	if names, ok := pod.ObjectMeta.Annotations[bindingsAnnotation]; ok {
+		filteredBindings = selectBindings(filteredBindings, names)
+		clusterBindings = selectBindings(clusterBindings, names)
+	}
+
+	// Identify bindings with ServiceAccount field matching the pod's ServiceAccountName, and PodSelector matching its labels
+	databases := mergeDatabases(matchBindings(filteredBindings, &pod), matchBindings(clusterBindings, &pod))
 	if len(databases) == 0 {
 		log.Infof("Skipping mutation for %s/%s due to policy check", req.Namespace, ownerName)
-		return &v1beta1.AdmissionResponse{
+		return &admissionv1.AdmissionResponse{
 			Allowed: true,
 		}
 	}
 
+	owner := ownerReference(&pod, req.Namespace)
+	name := podName(&pod)
+
+	limitRanges := srv.namespaceLimitRanges(req.Namespace)
+
+	deadline := srv.activeDeadline(&pod, req.Namespace)
+	restricted := restrictedSecurityContext || srv.enforcesRestricted(req.Namespace)
+	for i, d := range databases {
+		databases[i].nativeSidecar = useNativeSidecar(d.vaultContainer.SidecarMode, srv.nativeSidecars)
+		databases[i].restricted = restricted
+		databases[i].leaseDuration = capLeaseDuration(d.leaseDuration, deadline)
+
+		resources, err := sidecarResources(srv.sidecarResources, d.vaultContainer.Resources, limitRanges)
+		if err != nil {
+			err = fmt.Errorf("invalid resources for the vault-creds sidecar for %s/%s: %v", d.database, d.role, err)
+			srv.recordEvent(req, []*corev1.ObjectReference{d.binding, owner}, corev1.EventTypeWarning, reasonPatchFailed,
+				"Failed to inject vault-creds into pod %s: %v", name, err)
+			return &admissionv1.AdmissionResponse{
+				Result: &metav1.Status{
+					Message: err.Error(),
+				},
+			}
+		}
+		databases[i].resources = resources
+
+		if d.sidecarProvider().NeedsNativeSidecar() && !databases[i].nativeSidecar {
+			err := fmt.Errorf("the sidecar provider for %s/%s needs native sidecars, set sidecarMode to native or use the vault-creds provider", d.database, d.role)
+			srv.recordEvent(req, []*corev1.ObjectReference{d.binding, owner}, corev1.EventTypeWarning, reasonPatchFailed,
+				"Failed to inject vault-creds into pod %s: %v", name, err)
+			return &admissionv1.AdmissionResponse{
+				Result: &metav1.Status{
+					Message: err.Error(),
+				},
+			}
+		}
+
+		if d.vaultConnectionName != "" {
+			connection, err := srv.vaultConnection(d.vaultConnectionName)
+			if err != nil {
+				err = fmt.Errorf("invalid Vault connection for the vault-creds sidecar for %s/%s: %v", d.database, d.role, err)
+				srv.recordEvent(req, []*corev1.ObjectReference{d.binding, owner}, corev1.EventTypeWarning, reasonPatchFailed,
+					"Failed to inject vault-creds into pod %s: %v", name, err)
+				return &admissionv1.AdmissionResponse{
+					Result: &metav1.Status{
+						Message: err.Error(),
+					},
+				}
+			}
+			databases[i].connection = connection
+		}
+
+		authRole, err := vaultAuthRole(d, req.Namespace)
+		if err != nil {
+			err = fmt.Errorf("invalid auth role for the vault-creds sidecar for %s/%s: %v", d.database, d.role, err)
+			srv.recordEvent(req, []*corev1.ObjectReference{d.binding, owner}, corev1.EventTypeWarning, reasonPatchFailed,
+				"Failed to inject vault-creds into pod %s: %v", name, err)
+			return &admissionv1.AdmissionResponse{
+				Result: &metav1.Status{
+					Message: err.Error(),
+				},
+			}
+		}
+		databases[i].authRole = authRole
+	}
+
+	if conflicts := conflictingMounts(&pod, databases); len(conflicts) != 0 {
+		err := fmt.Errorf("conflicting credential mounts: %s", strings.Join(conflicts, "; "))
+		srv.recordEvent(req, append(databaseBindings(databases), owner), corev1.EventTypeWarning, reasonPatchFailed,
+			"Failed to inject vault-creds into pod %s: %v", name, err)
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+
+	missingTemplates := srv.missingTemplates(&pod, req.Namespace, missingDatabases(&pod, databases))
+	if len(missingTemplates) != 0 && srv.missingTemplatePolicy == missingTemplatePolicyDeny {
+		err := fmt.Errorf("missing templates: %s", strings.Join(missingTemplates, "; "))
+		srv.recordEvent(req, append(databaseBindings(databases), owner), corev1.EventTypeWarning, reasonPatchFailed,
+			"Failed to inject vault-creds into pod %s: %v", name, err)
+		return &admissionv1.AdmissionResponse{
+			Result: &metav1.Status{
+				Message: err.Error(),
+			},
+		}
+	}
+	for _, warning := range missingTemplates {
+		log.Warnf("Injecting vault-creds into pod %s/%s with a missing template: %s", req.Namespace, name, warning)
+	}
+
 	patchBytes, err := createPatch(&pod, req.Namespace, databases)
 	if err != nil {
-		return &v1beta1.AdmissionResponse{
+		for _, d := range databases {
+			srv.recordEvent(req, []*corev1.ObjectReference{d.binding}, corev1.EventTypeWarning, reasonPatchFailed,
+				"Failed to inject vault-creds for %s/%s into pod %s: %v", d.database, d.role, name, err)
+		}
+		srv.recordEvent(req, []*corev1.ObjectReference{owner}, corev1.EventTypeWarning, reasonPatchFailed,
+			"Failed to inject vault-creds into pod %s: %v", name, err)
+		return &admissionv1.AdmissionResponse{
 			Result: &metav1.Status{
 				Message: err.Error(),
 			},
 		}
 	}
+	if patchBytes == nil {
+		log.Infof("Skipping mutation for %s/%s, vault-creds containers already injected", req.Namespace, ownerName)
+		srv.recordEvent(req, append(databaseBindings(databases), owner), corev1.EventTypeNormal, reasonInjectionSkipped,
+			"Skipped injecting vault-creds into pod %s, containers already present", name)
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+
+	for _, d := range databases {
+		srv.recordEvent(req, []*corev1.ObjectReference{d.binding}, corev1.EventTypeNormal, reasonCredentialsInjected,
+			"Injected vault-creds for %s/%s into pod %s", d.database, d.role, name)
+	}
+	srv.recordEvent(req, []*corev1.ObjectReference{owner}, corev1.EventTypeNormal, reasonCredentialsInjected,
+		"Injected vault-creds for %s into pod %s", databaseNames(databases), name)
 
 	log.Infof("AdmissionResponse: patch=%v\n", string(patchBytes))
-	return &v1beta1.AdmissionResponse{
-		Allowed: true,
-		Patch:   patchBytes,
-		PatchType: func() *v1beta1.PatchType {
-			pt := v1beta1.PatchTypeJSONPatch
+	return &admissionv1.AdmissionResponse{
+		Allowed:  true,
+		Warnings: missingTemplates,
+		Patch:    patchBytes,
+		PatchType: func() *admissionv1.PatchType {
+			pt := admissionv1.PatchTypeJSONPatch
 			return &pt
 		}(),
 	}
 }
 
+// namespaceLimitRanges are the LimitRanges the sidecar resources are fitted into. When they can't be
+// listed the resources aren't clamped rather than holding up every pod in the namespace.
+func (srv webHookServer) namespaceLimitRanges(namespace string) []corev1.LimitRange {
+	limitRanges, err := srv.limitRanges.LimitRanges(namespace).List(labels.Everything())
+	if err != nil {
+		log.Warnf("Error listing limit ranges in namespace %s, not fitting the sidecar resources into them: %v", namespace, err)
+		return nil
+	}
+	items := make([]corev1.LimitRange, 0, len(limitRanges))
+	for _, limitRange := range limitRanges {
+		items = append(items, *limitRange)
+	}
+	return items
+}
+
+// namespaceClusterBindings returns the ClusterDatabaseCredentialBindings that apply to the namespace,
+// as DatabaseCredentialBindings in that namespace so they can be matched like any other binding.
+func (srv webHookServer) namespaceClusterBindings(namespace string) ([]v1alpha1.DatabaseCredentialBinding, error) {
+	clusterBindings, err := srv.clusterBindings.List()
+	if err != nil {
+		return nil, err
+	}
+	// avoid looking up the namespace when there's nothing to match it against
+	if len(clusterBindings) == 0 {
+		return []v1alpha1.DatabaseCredentialBinding{}, nil
+	}
+
+	ns, err := srv.namespaces.Get(namespace)
+	if err != nil {
+		// don't hold up every pod in the namespace, its own bindings are still injected
+		log.Warnf("Error getting namespace %s, not injecting cluster bindings: %v", namespace, err)
+		return []v1alpha1.DatabaseCredentialBinding{}, nil
+	}
+
+	return filterClusterBindings(clusterBindings, ns), nil
+}
+
+// For all the cluster bindings, we need to find the ones whose NamespaceSelector matches the namespace
+func filterClusterBindings(clusterBindings []v1alpha1.ClusterDatabaseCredentialBinding, namespace *corev1.Namespace) []v1alpha1.DatabaseCredentialBinding {
+	filteredBindings := []v1alpha1.DatabaseCredentialBinding{}
+	for _, clusterBinding := range clusterBindings {
+		// a missing selector matches nothing rather than every namespace
+		selector, err := metav1.LabelSelectorAsSelector(clusterBinding.Spec.NamespaceSelector)
+		if err != nil {
+			log.Errorf("Invalid namespaceSelector on cluster binding %s: %v", clusterBinding.Name, err)
+			continue
+		}
+		if !selector.Matches(labels.Set(namespace.Labels)) {
+			continue
+		}
+		// the kind and UID are kept so events refer to the cluster binding
+		filteredBindings = append(filteredBindings, v1alpha1.DatabaseCredentialBinding{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Kind:       "ClusterDatabaseCredentialBinding",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      clusterBinding.Name,
+				Namespace: namespace.Name,
+				UID:       clusterBinding.UID,
+			},
+			Spec: clusterBinding.Spec.DatabaseCredentialBindingSpec,
+		})
+	}
+	return filteredBindings
+}
+
+// vaultConnection looks up the named VaultConnection
+func (srv webHookServer) vaultConnection(name string) (*vaultConnection, error) {
+	connection, err := srv.connections.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if connection == nil {
+		return nil, fmt.Errorf("VaultConnection %s not found", name)
+	}
+	c := newVaultConnection(connection)
+	return &c, nil
+}
+
+// mergeDatabases adds the cluster databases to the namespaced ones, a namespaced binding
+// for the same database and role wins over the cluster binding.
+func mergeDatabases(namespaced []database, cluster []database) []database {
+	merged := namespaced
+	for _, c := range cluster {
+		conflict := false
+		for _, n := range namespaced {
+			if n.database == c.database && n.role == c.role {
+				conflict = true
+				break
+			}
+		}
+		if !conflict {
+			merged = appendIfMissing(merged, c)
+		}
+	}
+	return merged
+}
+
+// The v1beta1 and v1 admission types are structurally identical, so mutate and validate
+// only deal in v1 and v1beta1 requests are converted on the way in and out.
+func toV1AdmissionRequest(req *v1beta1.AdmissionRequest) *admissionv1.AdmissionRequest {
+	return &admissionv1.AdmissionRequest{
+		UID:                req.UID,
+		Kind:               req.Kind,
+		Resource:           req.Resource,
+		SubResource:        req.SubResource,
+		RequestKind:        req.RequestKind,
+		RequestResource:    req.RequestResource,
+		RequestSubResource: req.RequestSubResource,
+		Name:               req.Name,
+		Namespace:          req.Namespace,
+		Operation:          admissionv1.Operation(req.Operation),
+		UserInfo:           req.UserInfo,
+		Object:             req.Object,
+		OldObject:          req.OldObject,
+		DryRun:             req.DryRun,
+		Options:            req.Options,
+	}
+}
+
+func toV1beta1AdmissionResponse(resp *admissionv1.AdmissionResponse) *v1beta1.AdmissionResponse {
+	var patchType *v1beta1.PatchType
+	if resp.PatchType != nil {
+		pt := v1beta1.PatchType(*resp.PatchType)
+		patchType = &pt
+	}
+	return &v1beta1.AdmissionResponse{
+		UID:              resp.UID,
+		Allowed:          resp.Allowed,
+		Result:           resp.Result,
+		Patch:            resp.Patch,
+		PatchType:        patchType,
+		AuditAnnotations: resp.AuditAnnotations,
+		Warnings:         resp.Warnings,
+	}
+}
+
 // For all the bindings, we need to find the ones in the target namespace
 func filterBindings(bindings []v1alpha1.DatabaseCredentialBinding, namespace string) []v1alpha1.DatabaseCredentialBinding {
 	filteredBindings := []v1alpha1.DatabaseCredentialBinding{}
@@ -183,39 +557,127 @@ func filterBindings(bindings []v1alpha1.DatabaseCredentialBinding, namespace str
 	return filteredBindings
 }
 
+// Keep the bindings named in a comma separated list, as found in the bindings annotation
+func selectBindings(bindings []v1alpha1.DatabaseCredentialBinding, names string) []v1alpha1.DatabaseCredentialBinding {
+	wanted := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			wanted[name] = true
+		}
+	}
+
+	selectedBindings := []v1alpha1.DatabaseCredentialBinding{}
+	for _, binding := range bindings {
+		if wanted[binding.Name] {
+			selectedBindings = append(selectedBindings, binding)
+		}
+	}
+	return selectedBindings
+}
+
 /*
 	    For all the bindings in the namespace, check which one has a ServiceeAccount that matches the pod's ServiceAccount
 		  - We could have multiple database specifications to be attached to a single pod.
 		  - This means that we could also have different VaultContainer specs for each DatabaseCredentialBinding.
 		  - As a consequence, to keep things consistent and easy to follow, we are appending into the `database` slice.
+		  - The ServiceAccount can be any of the binding's ServiceAccount or ServiceAccounts, the matched one is kept for the Vault auth role.
+		  - When a binding has a PodSelector the pod's labels must match it as well.
 */
-func matchBindings(bindings []v1alpha1.DatabaseCredentialBinding, serviceAccount string) []database {
+func matchBindings(bindings []v1alpha1.DatabaseCredentialBinding, pod *corev1.Pod) []database {
 	matchedBindings := []database{}
 	for _, binding := range bindings {
-		if binding.Spec.ServiceAccount == serviceAccount {
+		if binding.Spec.HasServiceAccount(pod.Spec.ServiceAccountName) && matchPodSelector(binding, pod) {
 			output := binding.Spec.OutputPath
 			if output == "" {
-				output = "/etc/database"
+				output = database{database: binding.Spec.Database, role: binding.Spec.Role, volumeIsolation: binding.Spec.Volume.Isolation}.defaultOutputPathFor()
 			}
 			log.Infof("[matchBindings] Printing content of Container: %+v", binding.Spec.Container)
 
 			matchedBindings = appendIfMissing(matchedBindings, database{
-				role:           binding.Spec.Role,
-				database:       binding.Spec.Database,
-				outputPath:     output,
-				outputFile:     binding.Spec.OutputFile,
-				vaultContainer: binding.Spec.Container,
+				role:                binding.Spec.Role,
+				database:            binding.Spec.Database,
+				outputPath:          output,
+				outputFile:          binding.Spec.OutputFile,
+				serviceAccount:      pod.Spec.ServiceAccountName,
+				vaultContainer:      binding.Spec.Container,
+				provider:            binding.Spec.Container.Provider,
+				renewInterval:       durationOrDefault(binding.Spec.RenewInterval, defaultRenewInterval),
+				leaseDuration:       durationOrDefault(binding.Spec.LeaseDuration, defaultLeaseDuration),
+				template:            binding.Spec.Template,
+				templateFrom:        binding.Spec.TemplateFrom,
+				authRole:            binding.Spec.AuthRole,
+				loginPath:           binding.Spec.LoginPath,
+				vaultConnectionName: binding.Spec.VaultConnection,
+				vaultNamespace:      binding.Spec.VaultNamespace,
+				envVar:              binding.Spec.EnvVar,
+				containers:          binding.Spec.Containers,
+				skipInitContainers:  binding.Spec.InitContainers != nil && !*binding.Spec.InitContainers,
+				volumeIsolation:     binding.Spec.Volume.Isolation,
+				volumeMedium:        binding.Spec.Volume.Medium,
+				sizeLimit:           binding.Spec.Volume.SizeLimit,
+				binding:             bindingReference(binding),
 			})
 		}
 	}
 	return matchedBindings
 }
 
+func durationOrDefault(d *metav1.Duration, defaultDuration time.Duration) time.Duration {
+	if d == nil {
+		return defaultDuration
+	}
+	return d.Duration
+}
+
+// activeDeadline is how long a job-like pod can run for, the shorter of its own and its
+// Job's activeDeadlineSeconds, or zero if it doesn't have one
+func (srv webHookServer) activeDeadline(pod *corev1.Pod, namespace string) time.Duration {
+	if !isJobLike(pod) {
+		return 0
+	}
+
+	var deadline time.Duration
+	if pod.Spec.ActiveDeadlineSeconds != nil {
+		deadline = time.Duration(*pod.Spec.ActiveDeadlineSeconds) * time.Second
+	}
+
+	owner := pod.ObjectMeta.OwnerReferences[0]
+	if owner.Kind != "Job" {
+		return deadline
+	}
+	job, err := srv.jobs.Jobs(namespace).Get(owner.Name)
+	if err != nil {
+		log.Warnf("Error getting job %s/%s, not capping the lease at its deadline: %v", namespace, owner.Name, err)
+		return deadline
+	}
+	if job.Spec.ActiveDeadlineSeconds != nil {
+		jobDeadline := time.Duration(*job.Spec.ActiveDeadlineSeconds) * time.Second
+		if deadline == 0 || jobDeadline < deadline {
+			deadline = jobDeadline
+		}
+	}
+	return deadline
+}
+
+// A binding without a PodSelector matches every pod, an invalid selector matches none
+func matchPodSelector(binding v1alpha1.DatabaseCredentialBinding, pod *corev1.Pod) bool {
+	if binding.Spec.PodSelector == nil {
+		return true
+	}
+	selector, err := metav1.LabelSelectorAsSelector(binding.Spec.PodSelector)
+	if err != nil {
+		log.Errorf("Invalid podSelector on binding %s/%s: %v", binding.Namespace, binding.Name, err)
+		return false
+	}
+	return selector.Matches(labels.Set(pod.ObjectMeta.Labels))
+}
+
 func appendIfMissing(slice []database, d database) []database {
 	for _, ele := range slice {
 		// No need to compare Container fields.
 		if ele.role == d.role &&
 			ele.database == d.database &&
+			ele.serviceAccount == d.serviceAccount &&
 			ele.outputPath == d.outputPath &&
 			ele.outputFile == d.outputFile {
 			return slice
@@ -224,6 +686,22 @@ func appendIfMissing(slice []database, d database) []database {
 	return append(slice, d)
 }
 
+// Pods are usually named by the API server after admission, so fall back to the generateName prefix
+func podName(pod *corev1.Pod) string {
+	if pod.Name != "" {
+		return pod.Name
+	}
+	return pod.GenerateName
+}
+
+func databaseNames(databases []database) string {
+	names := []string{}
+	for _, d := range databases {
+		names = append(names, d.database+"/"+d.role)
+	}
+	return strings.Join(names, ", ")
+}
+
 func (srv webHookServer) checkHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 }
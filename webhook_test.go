@@ -1,10 +1,29 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/uswitch/vault-webhook/pkg/apis/vaultwebhook.uswitch.com/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/api/admission/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
 func TestFilterBindings(t *testing.T) {
@@ -43,8 +62,881 @@ func TestMatchBindings(t *testing.T) {
 		},
 	}
 
-	databases := matchBindings(bindings, "bah")
+	pod := &v1.Pod{Spec: v1.PodSpec{ServiceAccountName: "bah"}}
+	databases := matchBindings(bindings, pod)
 	if len(databases) != 1 {
 		t.Errorf("should have got one database, got: %v", len(databases))
 	}
 }
+
+func TestMatchBindingsServiceAccounts(t *testing.T) {
+	bindings := []v1alpha1.DatabaseCredentialBinding{
+		v1alpha1.DatabaseCredentialBinding{
+			Spec: v1alpha1.DatabaseCredentialBindingSpec{
+				ServiceAccount: "foo",
+				Database:       "mydb",
+				Role:           "readonly",
+			},
+		},
+		v1alpha1.DatabaseCredentialBinding{
+			Spec: v1alpha1.DatabaseCredentialBindingSpec{
+				ServiceAccounts: []string{"foo", "bah", "baz"},
+				Database:        "mydb",
+				Role:            "readonly",
+			},
+		},
+		v1alpha1.DatabaseCredentialBinding{
+			Spec: v1alpha1.DatabaseCredentialBindingSpec{
+				ServiceAccounts: []string{"baz"},
+				Database:        "otherdb",
+				Role:            "readonly",
+			},
+		},
+	}
+
+	var tests = []struct {
+		serviceAccount string
+		databases      []string
+	}{
+		{"foo", []string{"mydb"}},
+		{"bah", []string{"mydb"}},
+		{"baz", []string{"mydb", "otherdb"}},
+		{"qux", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serviceAccount, func(t *testing.T) {
+			pod := &v1.Pod{Spec: v1.PodSpec{ServiceAccountName: tt.serviceAccount}}
+			databases := matchBindings(bindings, pod)
+			if len(databases) != len(tt.databases) {
+				t.Fatalf("expected databases %v, got: %+v", tt.databases, databases)
+			}
+			for i, d := range databases {
+				if d.database != tt.databases[i] {
+					t.Errorf("expected databases %v, got: %+v", tt.databases, databases)
+				}
+				if d.serviceAccount != tt.serviceAccount {
+					t.Errorf("expected service account %v, got: %v", tt.serviceAccount, d.serviceAccount)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchBindingsPodSelector(t *testing.T) {
+	binding := func(database string, selector *metav1.LabelSelector) v1alpha1.DatabaseCredentialBinding {
+		return v1alpha1.DatabaseCredentialBinding{
+			Spec: v1alpha1.DatabaseCredentialBindingSpec{
+				ServiceAccount: "foo",
+				Database:       database,
+				PodSelector:    selector,
+			},
+		}
+	}
+
+	bindings := []v1alpha1.DatabaseCredentialBinding{
+		binding("nosel", nil),
+		binding("labels", &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}),
+		binding("expressions", &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"frontend", "backend"}},
+			},
+		}),
+		binding("invalid", &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: "Bogus"},
+			},
+		}),
+	}
+
+	var tests = []struct {
+		scenario       string
+		serviceAccount string
+		labels         map[string]string
+		databases      []string
+	}{
+		{"no labels", "foo", nil, []string{"nosel"}},
+		{"matching labels", "foo", map[string]string{"app": "web"}, []string{"nosel", "labels"}},
+		{"matching expressions", "foo", map[string]string{"app": "web", "tier": "backend"}, []string{"nosel", "labels", "expressions"}},
+		{"labels match but service account does not", "bah", map[string]string{"app": "web", "tier": "backend"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: tt.labels},
+				Spec:       v1.PodSpec{ServiceAccountName: tt.serviceAccount},
+			}
+			databases := matchBindings(bindings, pod)
+			if len(databases) != len(tt.databases) {
+				t.Fatalf("expected databases %v, got: %+v", tt.databases, databases)
+			}
+			for i, d := range databases {
+				if d.database != tt.databases[i] {
+					t.Errorf("expected databases %v, got: %+v", tt.databases, databases)
+				}
+			}
+		})
+	}
+}
+
+func newTestServer(t *testing.T, bindings ...v1alpha1.DatabaseCredentialBinding) webHookServer {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for i := range bindings {
+		if err := store.Add(&bindings[i]); err != nil {
+			t.Fatalf("could not add binding to store: %v", err)
+		}
+	}
+	return webHookServer{
+		client:          fake.NewClientset(),
+		bindings:        &bindingAggregator{store: store},
+		clusterBindings: &clusterBindingAggregator{bindingAggregator{store: cache.NewStore(cache.MetaNamespaceKeyFunc)}},
+		connections:     &connectionAggregator{bindingAggregator{store: cache.NewStore(cache.MetaNamespaceKeyFunc)}},
+		namespaces:      namespaceLister(t),
+		limitRanges:     limitRangeLister(t),
+		jobs:            jobLister(t),
+		configMaps:      configMapLister(t),
+		ctx:             context.Background(),
+	}
+}
+
+func limitRangeLister(t *testing.T, limitRanges ...*v1.LimitRange) corelisters.LimitRangeLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, limitRange := range limitRanges {
+		if err := indexer.Add(limitRange); err != nil {
+			t.Fatalf("could not add limit range to indexer: %v", err)
+		}
+	}
+	return corelisters.NewLimitRangeLister(indexer)
+}
+
+func jobLister(t *testing.T, jobs ...*batchv1.Job) batchlisters.JobLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, job := range jobs {
+		if err := indexer.Add(job); err != nil {
+			t.Fatalf("could not add job to indexer: %v", err)
+		}
+	}
+	return batchlisters.NewJobLister(indexer)
+}
+
+func configMapLister(t *testing.T, configMaps ...*v1.ConfigMap) corelisters.ConfigMapLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, configMap := range configMaps {
+		if err := indexer.Add(configMap); err != nil {
+			t.Fatalf("could not add config map to indexer: %v", err)
+		}
+	}
+	return corelisters.NewConfigMapLister(indexer)
+}
+
+func namespaceLister(t *testing.T, namespaces ...*v1.Namespace) corelisters.NamespaceLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, namespace := range namespaces {
+		if err := indexer.Add(namespace); err != nil {
+			t.Fatalf("could not add namespace to indexer: %v", err)
+		}
+	}
+	return corelisters.NewNamespaceLister(indexer)
+}
+
+func testPodRaw(t *testing.T) runtime.RawExtension {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+		Spec: v1.PodSpec{
+			ServiceAccountName: "foo",
+			Containers:         []v1.Container{v1.Container{Name: "app"}},
+		},
+	}
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("could not marshal pod: %v", err)
+	}
+	return runtime.RawExtension{Raw: raw}
+}
+
+func postReview(t *testing.T, srv webHookServer, review interface{}) []byte {
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatalf("could not marshal review: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	srv.serve(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Body.Bytes()
+}
+
+func TestServeAdmissionReviewVersions(t *testing.T) {
+	srv := newTestServer(t, v1alpha1.DatabaseCredentialBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+		Spec: v1alpha1.DatabaseCredentialBindingSpec{
+			ServiceAccount: "foo",
+			Database:       "foo",
+			Role:           "bah",
+		},
+	})
+	uid := types.UID("b5f7c4a2-1b0e-4c8e-9d0e-3f7a6f0b2c11")
+
+	t.Run("v1", func(t *testing.T) {
+		review := admissionv1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+			Request: &admissionv1.AdmissionRequest{
+				UID:       uid,
+				Namespace: "foo",
+				Operation: admissionv1.Create,
+				Object:    testPodRaw(t),
+			},
+		}
+
+		var resp admissionv1.AdmissionReview
+		if err := json.Unmarshal(postReview(t, srv, review), &resp); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if resp.APIVersion != "admission.k8s.io/v1" || resp.Kind != "AdmissionReview" {
+			t.Errorf("response should echo apiVersion and kind, got: %v %v", resp.APIVersion, resp.Kind)
+		}
+		if resp.Response == nil || resp.Response.UID != uid {
+			t.Fatalf("response should echo request uid, got: %+v", resp.Response)
+		}
+		if !resp.Response.Allowed || len(resp.Response.Patch) == 0 {
+			t.Errorf("expected an allowed response with a patch, got: %+v", resp.Response)
+		}
+		if resp.Response.PatchType == nil || *resp.Response.PatchType != admissionv1.PatchTypeJSONPatch {
+			t.Errorf("expected a JSONPatch patch type, got: %v", resp.Response.PatchType)
+		}
+	})
+
+	t.Run("v1beta1", func(t *testing.T) {
+		review := v1beta1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1beta1", Kind: "AdmissionReview"},
+			Request: &v1beta1.AdmissionRequest{
+				UID:       uid,
+				Namespace: "foo",
+				Operation: v1beta1.Create,
+				Object:    testPodRaw(t),
+			},
+		}
+
+		var resp v1beta1.AdmissionReview
+		if err := json.Unmarshal(postReview(t, srv, review), &resp); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if resp.APIVersion != "admission.k8s.io/v1beta1" || resp.Kind != "AdmissionReview" {
+			t.Errorf("response should echo apiVersion and kind, got: %v %v", resp.APIVersion, resp.Kind)
+		}
+		if resp.Response == nil || resp.Response.UID != uid {
+			t.Fatalf("response should echo request uid, got: %+v", resp.Response)
+		}
+		if !resp.Response.Allowed || len(resp.Response.Patch) == 0 {
+			t.Errorf("expected an allowed response with a patch, got: %+v", resp.Response)
+		}
+	})
+
+	t.Run("unversioned", func(t *testing.T) {
+		review := map[string]interface{}{
+			"request": map[string]interface{}{
+				"uid":       uid,
+				"namespace": "bah",
+				"operation": "CREATE",
+				"object":    testPodRaw(t),
+			},
+		}
+
+		var resp v1beta1.AdmissionReview
+		if err := json.Unmarshal(postReview(t, srv, review), &resp); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if resp.APIVersion != "admission.k8s.io/v1beta1" {
+			t.Errorf("unversioned reviews should be answered as v1beta1, got: %v", resp.APIVersion)
+		}
+		if resp.Response == nil || !resp.Response.Allowed || len(resp.Response.Patch) != 0 {
+			t.Errorf("expected an allowed response without a patch, got: %+v", resp.Response)
+		}
+	})
+}
+
+func TestSelectBindings(t *testing.T) {
+	bindings := []v1alpha1.DatabaseCredentialBinding{
+		v1alpha1.DatabaseCredentialBinding{ObjectMeta: metav1.ObjectMeta{Name: "foo"}},
+		v1alpha1.DatabaseCredentialBinding{ObjectMeta: metav1.ObjectMeta{Name: "bah"}},
+		v1alpha1.DatabaseCredentialBinding{ObjectMeta: metav1.ObjectMeta{Name: "baz"}},
+	}
+
+	selected := selectBindings(bindings, "foo, baz")
+	if len(selected) != 2 || selected[0].Name != "foo" || selected[1].Name != "baz" {
+		t.Errorf("should have selected foo and baz, got: %+v", selected)
+	}
+
+	if selected := selectBindings(bindings, ""); len(selected) != 0 {
+		t.Errorf("an empty annotation should select nothing, got: %+v", selected)
+	}
+}
+
+func TestMutatePodAnnotations(t *testing.T) {
+	srv := newTestServer(t,
+		v1alpha1.DatabaseCredentialBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+			Spec:       v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "foo", Role: "bah"},
+		},
+		v1alpha1.DatabaseCredentialBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "bah", Namespace: "foo"},
+			Spec:       v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "bah", Role: "foo"},
+		},
+	)
+
+	var tests = []struct {
+		scenario    string
+		annotations map[string]string
+		containers  []string
+	}{
+		{
+			scenario:   "no annotations injects every matching binding",
+			containers: []string{"vault-creds-bah-foo", "vault-creds-foo-bah"},
+		},
+		{
+			scenario:    "inject false skips injection",
+			annotations: map[string]string{injectAnnotation: "false"},
+		},
+		{
+			scenario:    "inject true injects every matching binding",
+			annotations: map[string]string{injectAnnotation: "true"},
+			containers:  []string{"vault-creds-bah-foo", "vault-creds-foo-bah"},
+		},
+		{
+			scenario:    "bindings restricts to the named bindings",
+			annotations: map[string]string{bindingsAnnotation: "bah"},
+			containers:  []string{"vault-creds-bah-foo"},
+		},
+		{
+			scenario:    "bindings naming an unknown binding injects nothing",
+			annotations: map[string]string{bindingsAnnotation: "baz"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			pod := v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo", Annotations: tt.annotations},
+				Spec: v1.PodSpec{
+					ServiceAccountName: "foo",
+					Containers:         []v1.Container{v1.Container{Name: "app"}},
+				},
+			}
+			raw, _ := json.Marshal(pod)
+
+			resp := srv.mutate(&admissionv1.AdmissionRequest{
+				Namespace: "foo",
+				Object:    runtime.RawExtension{Raw: raw},
+			})
+			if !resp.Allowed {
+				t.Fatalf("pod should be allowed, got: %+v", resp.Result)
+			}
+
+			var ops []patchOperation
+			if len(resp.Patch) != 0 {
+				if err := json.Unmarshal(resp.Patch, &ops); err != nil {
+					t.Fatalf("could not decode patch: %v", err)
+				}
+			}
+
+			injected := []string{}
+			for _, op := range ops {
+				if op.Path != "/spec/containers/-" {
+					continue
+				}
+				injected = append(injected, op.Value.(map[string]interface{})["name"].(string))
+			}
+
+			sort.Strings(injected)
+			sort.Strings(tt.containers)
+			if len(injected) != len(tt.containers) {
+				t.Fatalf("expected containers %v, got: %v", tt.containers, injected)
+			}
+			for i := range injected {
+				if injected[i] != tt.containers[i] {
+					t.Errorf("expected containers %v, got: %v", tt.containers, injected)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterClusterBindings(t *testing.T) {
+	clusterBindings := []v1alpha1.ClusterDatabaseCredentialBinding{
+		v1alpha1.ClusterDatabaseCredentialBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "data"},
+			Spec: v1alpha1.ClusterDatabaseCredentialBindingSpec{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "data"}},
+			},
+		},
+		v1alpha1.ClusterDatabaseCredentialBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "everyone"},
+			Spec: v1alpha1.ClusterDatabaseCredentialBindingSpec{
+				NamespaceSelector: &metav1.LabelSelector{},
+			},
+		},
+		v1alpha1.ClusterDatabaseCredentialBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "noselector"},
+		},
+	}
+
+	namespace := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "foo", Labels: map[string]string{"team": "data"}}}
+	bindings := filterClusterBindings(clusterBindings, namespace)
+	if len(bindings) != 2 || bindings[0].Name != "data" || bindings[1].Name != "everyone" {
+		t.Fatalf("should have got data and everyone bindings, got: %+v", bindings)
+	}
+	if bindings[0].Namespace != "foo" {
+		t.Errorf("cluster bindings should be placed in the pod namespace, got: %v", bindings[0].Namespace)
+	}
+
+	namespace = &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "bah", Labels: map[string]string{"team": "web"}}}
+	bindings = filterClusterBindings(clusterBindings, namespace)
+	if len(bindings) != 1 || bindings[0].Name != "everyone" {
+		t.Errorf("should have got the everyone binding, got: %+v", bindings)
+	}
+}
+
+func TestMergeDatabases(t *testing.T) {
+	namespaced := []database{
+		database{database: "foo", role: "bah", outputPath: "/etc/namespaced"},
+	}
+	cluster := []database{
+		database{database: "foo", role: "bah", outputPath: "/etc/cluster"},
+		database{database: "foo", role: "baz", outputPath: "/etc/cluster"},
+	}
+
+	databases := mergeDatabases(namespaced, cluster)
+	if len(databases) != 2 {
+		t.Fatalf("should have got two databases, got: %+v", databases)
+	}
+	if databases[0].outputPath != "/etc/namespaced" {
+		t.Errorf("namespaced binding should win, got: %+v", databases[0])
+	}
+	if databases[1].role != "baz" {
+		t.Errorf("non conflicting cluster binding should be kept, got: %+v", databases[1])
+	}
+}
+
+func TestMutateClusterBindings(t *testing.T) {
+	srv := newTestServer(t)
+	srv.namespaces = namespaceLister(t,
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "foo", Labels: map[string]string{"team": "data"}}},
+	)
+	srv.clusterBindings.store.Add(&v1alpha1.ClusterDatabaseCredentialBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "analytics"},
+		Spec: v1alpha1.ClusterDatabaseCredentialBindingSpec{
+			DatabaseCredentialBindingSpec: v1alpha1.DatabaseCredentialBindingSpec{
+				ServiceAccount: "foo",
+				Database:       "analytics",
+				Role:           "readonly",
+			},
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "data"}},
+		},
+	})
+
+	resp := srv.mutate(&admissionv1.AdmissionRequest{
+		Namespace: "foo",
+		Object:    testPodRaw(t),
+	})
+	if !resp.Allowed || len(resp.Patch) == 0 {
+		t.Errorf("expected the cluster binding to be injected, got: %+v", resp)
+	}
+
+	// a namespace missing from the cache doesn't hold up the pod, it just doesn't get the cluster binding
+	resp = srv.mutate(&admissionv1.AdmissionRequest{
+		Namespace: "bah",
+		Object:    testPodRaw(t),
+	})
+	if !resp.Allowed || len(resp.Patch) != 0 {
+		t.Errorf("expected the pod to be allowed without the cluster binding, got: %+v", resp)
+	}
+}
+
+func TestMutateEvents(t *testing.T) {
+	srv := newTestServer(t, v1alpha1.DatabaseCredentialBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+		Spec:       v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "readonly"},
+	})
+
+	isController := true
+	podRaw := func(annotations map[string]string, containers ...string) runtime.RawExtension {
+		pod := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "myapp-",
+				Namespace:    "foo",
+				Annotations:  annotations,
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "myapp", Controller: &isController},
+				},
+			},
+			Spec: v1.PodSpec{ServiceAccountName: "foo"},
+		}
+		for _, c := range containers {
+			pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: c})
+		}
+		pod.Spec.InitContainers = []v1.Container{v1.Container{Name: "vault-creds-mydb-readonly-init"}}
+		raw, _ := json.Marshal(pod)
+		return runtime.RawExtension{Raw: raw}
+	}
+	dryRun := true
+
+	var tests = []struct {
+		scenario string
+		request  *admissionv1.AdmissionRequest
+		events   []string
+	}{
+		{
+			scenario: "injected",
+			request:  &admissionv1.AdmissionRequest{Namespace: "foo", Object: podRaw(nil, "app")},
+			events: []string{
+				"Normal CredentialsInjected Injected vault-creds for mydb/readonly into pod myapp-",
+				"Normal CredentialsInjected Injected vault-creds for mydb/readonly into pod myapp-",
+			},
+		},
+		{
+			scenario: "dry run",
+			request:  &admissionv1.AdmissionRequest{Namespace: "foo", Object: podRaw(nil, "app"), DryRun: &dryRun},
+		},
+		{
+			scenario: "disabled by annotation",
+			request:  &admissionv1.AdmissionRequest{Namespace: "foo", Object: podRaw(map[string]string{injectAnnotation: "false"}, "app")},
+			events: []string{
+				"Normal InjectionSkipped Skipped injecting vault-creds into pod myapp-, disabled by vault-webhook.uswitch.com/inject annotation",
+			},
+		},
+		{
+			scenario: "already injected",
+			request:  &admissionv1.AdmissionRequest{Namespace: "foo", Object: podRaw(nil, "app", "vault-creds-mydb-readonly")},
+			events: []string{
+				"Normal InjectionSkipped Skipped injecting vault-creds into pod myapp-, containers already present",
+				"Normal InjectionSkipped Skipped injecting vault-creds into pod myapp-, containers already present",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			srv.recorder = recorder
+
+			srv.mutate(tt.request)
+			close(recorder.Events)
+
+			events := []string{}
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if len(events) != len(tt.events) {
+				t.Fatalf("expected events %v, got: %v", tt.events, events)
+			}
+			for i := range events {
+				if events[i] != tt.events[i] {
+					t.Errorf("expected events %v, got: %v", tt.events, events)
+				}
+			}
+		})
+	}
+}
+
+func TestMutateLimitRanges(t *testing.T) {
+	srv := newTestServer(t, v1alpha1.DatabaseCredentialBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+		Spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "readonly", Container: v1alpha1.Container{
+			Resources: v1.ResourceRequirements{Limits: resourceList("", "1Gi")},
+		}},
+	})
+	srv.sidecarResources = v1.ResourceRequirements{
+		Requests: resourceList("10m", "20Mi"),
+		Limits:   resourceList("30m", "50Mi"),
+	}
+	maxMemory := containerLimitRange("max-memory", v1.LimitRangeItem{Max: resourceList("", "512Mi")})
+	maxMemory.Namespace = "foo"
+	srv.limitRanges = limitRangeLister(t, &maxMemory)
+
+	resp := srv.mutate(&admissionv1.AdmissionRequest{Namespace: "foo", Object: testPodRaw(t)})
+	if !resp.Allowed {
+		t.Fatalf("pod should be allowed, got: %+v", resp.Result)
+	}
+	var ops []struct {
+		Path  string       `json:"path"`
+		Value v1.Container `json:"value"`
+	}
+	json.Unmarshal(resp.Patch, &ops)
+	clamped := false
+	for _, op := range ops {
+		if op.Path == "/spec/containers/-" {
+			clamped = op.Value.Resources.Limits.Memory().String() == "512Mi" && op.Value.Resources.Requests.Memory().String() == "20Mi"
+		}
+	}
+	if !clamped {
+		t.Errorf("sidecar memory limit should be clamped to the LimitRange, got: %s", resp.Patch)
+	}
+
+	minMemory := containerLimitRange("min-memory", v1.LimitRangeItem{Min: resourceList("", "1Gi")})
+	minMemory.Namespace = "foo"
+	srv.limitRanges = limitRangeLister(t, &maxMemory, &minMemory)
+
+	resp = srv.mutate(&admissionv1.AdmissionRequest{Namespace: "foo", Object: testPodRaw(t)})
+	if resp.Allowed {
+		t.Fatal("pod should be denied when the LimitRanges can't be satisfied")
+	}
+	if !strings.Contains(resp.Result.Message, "mydb/readonly") || !strings.Contains(resp.Result.Message, "LimitRange") {
+		t.Errorf("expected the binding and LimitRange in the message, got: %s", resp.Result.Message)
+	}
+}
+
+func TestActiveDeadline(t *testing.T) {
+	seconds := func(s int64) *int64 { return &s }
+	srv := newTestServer(t)
+	srv.jobs = jobLister(t,
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "migrate", Namespace: "foo"},
+			Spec:       batchv1.JobSpec{ActiveDeadlineSeconds: seconds(300)},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "backfill", Namespace: "foo"},
+		},
+	)
+
+	var tests = []struct {
+		scenario string
+		owner    string
+		name     string
+		deadline *int64
+		expected time.Duration
+	}{
+		{scenario: "deployment pod", owner: "ReplicaSet", name: "myapp", deadline: seconds(600), expected: 0},
+		{scenario: "job deadline", owner: "Job", name: "migrate", expected: 5 * time.Minute},
+		{scenario: "job deadline shorter than the pod's", owner: "Job", name: "migrate", deadline: seconds(600), expected: 5 * time.Minute},
+		{scenario: "pod deadline shorter than the job's", owner: "Job", name: "migrate", deadline: seconds(60), expected: time.Minute},
+		{scenario: "job without a deadline", owner: "Job", name: "backfill", expected: 0},
+		{scenario: "missing job", owner: "Job", name: "missing", deadline: seconds(600), expected: 10 * time.Minute},
+		{scenario: "workflow pod", owner: "Workflow", name: "pipeline", deadline: seconds(900), expected: 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			pod := makePodOwnedByKind(tt.owner)
+			pod.OwnerReferences[0].Name = tt.name
+			pod.Spec.ActiveDeadlineSeconds = tt.deadline
+
+			if actual := srv.activeDeadline(pod, "foo"); actual != tt.expected {
+				t.Errorf("expected deadline %s, got: %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMutateMissingTemplate(t *testing.T) {
+	templates := v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "templates", Namespace: "foo"},
+		Data:       map[string]string{"mydb-readonly": "{{ .Username }}"},
+	}
+	templateVolume := func(configMap string) []v1.Volume {
+		return []v1.Volume{{Name: "vault-template", VolumeSource: v1.VolumeSource{
+			ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: configMap}},
+		}}}
+	}
+
+	var tests = []struct {
+		scenario string
+		template string
+		volumes  []v1.Volume
+		policy   string
+		warning  string
+		denied   bool
+	}{
+		{
+			scenario: "template found",
+			volumes:  templateVolume("templates"),
+			policy:   missingTemplatePolicyDeny,
+		},
+		{
+			scenario: "binding with its own template",
+			template: "{{ .Username }}",
+			policy:   missingTemplatePolicyDeny,
+		},
+		{
+			scenario: "no template volume",
+			policy:   missingTemplatePolicyWarn,
+			warning:  "needs a vault-template volume with a mydb-readonly template",
+		},
+		{
+			scenario: "no template volume denied",
+			policy:   missingTemplatePolicyDeny,
+			warning:  "needs a vault-template volume with a mydb-readonly template",
+			denied:   true,
+		},
+		{
+			scenario: "template config map not found",
+			volumes:  templateVolume("missing"),
+			policy:   missingTemplatePolicyDeny,
+			warning:  "ConfigMap missing of the vault-template volume not found",
+			denied:   true,
+		},
+		{
+			scenario: "template config map not found with a warning",
+			volumes:  templateVolume("missing"),
+			policy:   missingTemplatePolicyWarn,
+			warning:  "ConfigMap missing of the vault-template volume not found",
+		},
+		{
+			scenario: "template key not in config map",
+			volumes: []v1.Volume{{Name: "vault-template", VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: "templates"},
+					Items:                []v1.KeyToPath{{Key: "mydb-readonly", Path: "other"}},
+				},
+			}}},
+			policy:  missingTemplatePolicyWarn,
+			warning: "ConfigMap templates of the vault-template volume has no mydb-readonly template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			srv := newTestServer(t, v1alpha1.DatabaseCredentialBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+				Spec:       v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "readonly", Template: tt.template},
+			})
+			srv.configMaps = configMapLister(t, &templates)
+			srv.missingTemplatePolicy = tt.policy
+
+			pod := v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+				Spec: v1.PodSpec{
+					ServiceAccountName: "foo",
+					Containers:         []v1.Container{v1.Container{Name: "app"}},
+					Volumes:            tt.volumes,
+				},
+			}
+			raw, _ := json.Marshal(pod)
+			resp := srv.mutate(&admissionv1.AdmissionRequest{Namespace: "foo", Object: runtime.RawExtension{Raw: raw}})
+
+			if tt.denied {
+				if resp.Allowed || !strings.Contains(resp.Result.Message, tt.warning) {
+					t.Fatalf("pod should be denied with %q, got: %+v", tt.warning, resp.Result)
+				}
+				return
+			}
+			if !resp.Allowed || len(resp.Patch) == 0 {
+				t.Fatalf("pod should be injected, got: %+v", resp.Result)
+			}
+			if tt.warning == "" && len(resp.Warnings) != 0 {
+				t.Errorf("pod should be allowed without warnings, got: %v", resp.Warnings)
+			}
+			if tt.warning != "" && (len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], tt.warning)) {
+				t.Errorf("expected a warning with %q, got: %v", tt.warning, resp.Warnings)
+			}
+
+			// every mount the patch adds has to be backed by a volume or the API server rejects the pod
+			patched := applyPatch(t, &pod, resp.Patch)
+			for _, c := range append(patched.Spec.InitContainers, patched.Spec.Containers...) {
+				for _, mount := range c.VolumeMounts {
+					if !hasVolume(&patched, mount.Name) {
+						t.Errorf("container %s mounts %s which isn't a volume of the pod", c.Name, mount.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMutateVaultConnection(t *testing.T) {
+	srv := newTestServer(t, v1alpha1.DatabaseCredentialBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+		Spec:       v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "readonly", VaultConnection: "eu-west-1"},
+	})
+
+	resp := srv.mutate(&admissionv1.AdmissionRequest{Namespace: "foo", Object: testPodRaw(t)})
+	if resp.Allowed {
+		t.Fatal("pod should be denied when the VaultConnection doesn't exist")
+	}
+	if !strings.Contains(resp.Result.Message, "VaultConnection eu-west-1 not found") {
+		t.Errorf("expected the missing VaultConnection in the message, got: %s", resp.Result.Message)
+	}
+
+	srv.connections.store.Add(&v1alpha1.VaultConnection{
+		ObjectMeta: metav1.ObjectMeta{Name: "eu-west-1"},
+		Spec:       v1alpha1.VaultConnectionSpec{Address: "https://vault.eu-west-1.example.com", LoginPath: "kubernetes-eu/login"},
+	})
+	resp = srv.mutate(&admissionv1.AdmissionRequest{Namespace: "foo", Object: testPodRaw(t)})
+	if !resp.Allowed {
+		t.Fatalf("pod should be allowed, got: %+v", resp.Result)
+	}
+	for _, arg := range []string{"--vault-addr=https://vault.eu-west-1.example.com", "--login-path=kubernetes-eu/login"} {
+		if !strings.Contains(string(resp.Patch), arg) {
+			t.Errorf("expected %s in the patch, got: %s", arg, resp.Patch)
+		}
+	}
+}
+
+func TestMutateVaultAgentNeedsNativeSidecar(t *testing.T) {
+	srv := newTestServer(t, v1alpha1.DatabaseCredentialBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+		Spec: v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "readonly", Container: v1alpha1.Container{
+			Provider: v1alpha1.SidecarProviderVaultAgent,
+		}},
+	})
+
+	resp := srv.mutate(&admissionv1.AdmissionRequest{Namespace: "foo", Object: testPodRaw(t)})
+	if resp.Allowed {
+		t.Fatal("pod should be denied when vault-agent can't run as a native sidecar")
+	}
+	if !strings.Contains(resp.Result.Message, "mydb/readonly") || !strings.Contains(resp.Result.Message, "native sidecars") {
+		t.Errorf("expected the binding and native sidecars in the message, got: %s", resp.Result.Message)
+	}
+
+	srv.nativeSidecars = true
+	resp = srv.mutate(&admissionv1.AdmissionRequest{Namespace: "foo", Object: testPodRaw(t)})
+	if !resp.Allowed {
+		t.Fatalf("pod should be allowed with native sidecars, got: %+v", resp.Result)
+	}
+	if strings.Contains(string(resp.Patch), "vault-creds-mydb-readonly-init") {
+		t.Errorf("expected no init container for vault-agent, got: %s", resp.Patch)
+	}
+}
+
+func TestMutateRestrictedNamespace(t *testing.T) {
+	var tests = []struct {
+		scenario   string
+		labels     map[string]string
+		restricted bool
+	}{
+		{scenario: "namespace enforcing restricted", labels: map[string]string{podSecurityEnforceLabel: "restricted"}, restricted: true},
+		{scenario: "namespace enforcing baseline", labels: map[string]string{podSecurityEnforceLabel: "baseline"}},
+		{scenario: "namespace without pod security labels"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			srv := newTestServer(t, v1alpha1.DatabaseCredentialBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "foo"},
+				Spec:       v1alpha1.DatabaseCredentialBindingSpec{ServiceAccount: "foo", Database: "mydb", Role: "readonly"},
+			})
+			srv.namespaces = namespaceLister(t, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "foo", Labels: tt.labels}})
+
+			resp := srv.mutate(&admissionv1.AdmissionRequest{Namespace: "foo", Object: testPodRaw(t)})
+			if !resp.Allowed {
+				t.Fatalf("pod should be allowed, got: %+v", resp.Result)
+			}
+			var ops []struct {
+				Path  string       `json:"path"`
+				Value v1.Container `json:"value"`
+			}
+			json.Unmarshal(resp.Patch, &ops)
+			for _, op := range ops {
+				if op.Path != "/spec/containers/-" {
+					continue
+				}
+				if restricted := op.Value.SecurityContext != nil && op.Value.SecurityContext.RunAsNonRoot != nil; restricted != tt.restricted {
+					t.Errorf("expected the restricted security context %t, got: %+v", tt.restricted, op.Value.SecurityContext)
+				}
+			}
+		})
+	}
+}